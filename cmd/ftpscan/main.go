@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+	"github.com/mickael-kerjean/ftpscan/internal/explore"
+	"github.com/mickael-kerjean/ftpscan/internal/index"
+	"github.com/mickael-kerjean/ftpscan/internal/maintain"
+	"github.com/mickael-kerjean/ftpscan/internal/scan"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"os"
+)
+
+// every phase of the pipeline is a subcommand, they share the flags parsed before the
+// name of the command
+var COMMANDS = map[string]func([]string){
+	"scan":        scan.Cmd,
+	"explore":     explore.Cmd,
+	"index":       index.Cmd,
+	"maintain":    maintain.Cmd,
+	"query":       queryCmd,
+	"export":      exportCmd,
+	"fingerprint": explore.FingerprintCmd,
+	"optout":      scan.OptoutCmd,
+	"rate":        scan.RateCmd,
+}
+
+var PHASES = map[string]bool{"scan": true, "explore": true, "index": true, "maintain": true}
+
+func main() {
+	path := flag.String("config", "ftpscan.toml", "config file, settings can also be given as FTPSCAN_* variables")
+	db := flag.String("db", "", "path of the sqlite database shared by every phase")
+	flag.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan [-config file] [-db file] command [arguments]
+
+Commands of the pipeline, in the order data flows through them:
+  scan         find hosts listening on the ports we care about
+  explore      probe the hosts found by the scan for anonymous access
+  index        crawl publicly available ftp servers
+  maintain     check again the hosts we haven't heard of for a while
+
+Other commands:
+  query        run a read only sql query against the database
+  export       export the hosts and what we know about them as csv
+  fingerprint  identify the software of servers again from what they told us
+  optout       manage the networks whose owner asked not to be scanned
+  rate         change the rate of the scans that are running
+
+Run 'ftpscan command -h' for the arguments of a command.
+
+Settings are read from the config file, then from the environment as FTPSCAN_<SECTION>_<NAME>
+(eg: FTPSCAN_SCAN_DIAL_TIMEOUT=5s, FTPSCAN_DB=ftp.sqlite) and last from the flags.
+`)
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	cmd, ok := COMMANDS[flag.Arg(0)]
+	if !ok {
+		fmt.Printf("ERROR unknown command '%s'\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(1)
+	}
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+	if env, ok := os.LookupEnv("FTPSCAN_CONFIG"); ok && !explicit {
+		*path, explicit = env, true
+	}
+	c := config.Config{
+		DB:       storage.PATH,
+		Scan:     scan.Settings(),
+		Explore:  explore.Settings(),
+		Index:    index.Settings(),
+		Maintain: maintain.Settings(),
+	}
+	if err := config.Load(&c, *path, explicit); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		os.Exit(1)
+	} else if *db != "" {
+		c.DB = *db
+	}
+	// commands other than the phases print their result, it has to stay on stdout
+	if PHASES[flag.Arg(0)] {
+		if err := setupOutput(c.Output); err != nil {
+			fmt.Printf("ERROR %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	config.CURRENT = c
+	storage.PATH = c.DB
+	scan.Configure(c.Scan)
+	explore.Configure(c.Explore)
+	index.Configure(c.Index)
+	maintain.Configure(c.Maintain)
+	cmd(flag.Args()[1:])
+}
+
+// setupOutput sends what we print to the log file and results to the results file
+func setupOutput(o config.Output) error {
+	if o.Log != "" && o.Log != "-" {
+		f, err := os.OpenFile(o.Log, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		os.Stdout = f
+	}
+	if o.Results != "" {
+		return storage.OpenResults(o.Results)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"os"
+	"strings"
+)
+
+func queryCmd(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	search := fs.Bool("search", false, "look for the words given in the names and paths of the indexed files")
+	limit := fs.Int("limit", 100, "maximum number of files found by -search")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan query "SELECT ..."
+       ftpscan query -search [-limit n] words...
+
+The result is printed as tab separated values, the database can't be modified from here.
+
+With -search the files found by the index phase whose name or path has every word given,
+or a word starting with it, come out with their host, path and size, the best matches
+first. Names are split on '_', '-', '.' and camelCase: "installer" finds DebianInstaller.iso.
+It needs a build with the fts5 extension of sqlite: go build -tags sqlite_fts5 ./cmd/ftpscan
+`)
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return
+	} else if *search && !storage.SEARCH {
+		fmt.Printf("ERROR search isn't available, ftpscan has to be built with -tags sqlite_fts5\n")
+		return
+	} else if err := storage.Open(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer storage.DB.Close()
+	// query_only is set on a connection, we make sure there's only one
+	storage.DB.SetMaxOpenConns(1)
+	if _, err := storage.DB.Exec("PRAGMA query_only = 1"); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	query, values := strings.Join(fs.Args(), " "), []interface{}{}
+	if *search {
+		match := storage.Match(query)
+		if match == "" {
+			fmt.Printf("ERROR no word to look for in '%s'\n", query)
+			return
+		}
+		query, values = SEARCH_QUERY, []interface{}{match, *limit}
+	}
+	rows, err := storage.DB.Query(query, values...)
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	fmt.Println(strings.Join(columns, "\t"))
+	err = eachRow(rows, len(columns), func(values []string) error {
+		_, err := fmt.Println(strings.Join(values, "\t"))
+		return err
+	})
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+	}
+}
+
+// SEARCH_QUERY ranks the files matching $1 with bm25, a match on the name weighing more
+// than one on the path
+const SEARCH_QUERY = `SELECT file.related_ip AS ip, file.related_port AS port,
+    rtrim(file.path, '/') || '/' || file.name AS path, file.size, file.type
+  FROM file_search JOIN file ON file.id = file_search.rowid
+  WHERE file_search MATCH $1 ORDER BY bm25(file_search, 1.0, 4.0) LIMIT $2`
+
+func exportCmd(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	available := fs.Bool("available", false, "only export the hosts that answered the explore phase")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan export [-available] > hosts.csv
+`)
+	}
+	fs.Parse(args)
+	if err := storage.Open(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer storage.DB.Close()
+	query := `SELECT host.ip, host.port, host.timestamp, COALESCE(host.banner, ''),
+    COALESCE(details.available, ''), COALESCE(details.anonymous, ''), COALESCE(details.ftps, '')
+  FROM host LEFT JOIN details ON host.ip = details.related_ip AND host.port = details.related_port`
+	if *available {
+		query += " WHERE details.available = 1"
+	}
+	rows, err := storage.DB.Query(query + " ORDER BY host.ip, host.port")
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer rows.Close()
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"ip", "port", "found_at", "banner", "available", "anonymous", "ftps"})
+	err = eachRow(rows, 7, func(values []string) error {
+		return w.Write(values)
+	})
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR %s\n", err.Error())
+	}
+}
+
+// eachRow hands every row over as text
+func eachRow(rows *sql.Rows, n int, fn func([]string) error) error {
+	values := make([]sql.NullString, n)
+	dest := make([]interface{}, n)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		out := make([]string, n)
+		for i, v := range values {
+			out[i] = v.String
+		}
+		if err := fn(out); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
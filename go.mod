@@ -0,0 +1,8 @@
+module github.com/mickael-kerjean/ftpscan
+
+go 1.16
+
+require (
+	github.com/BurntSushi/toml v1.0.0
+	github.com/mattn/go-sqlite3 v1.14.8
+)
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of every phase. Values come from the defaults of each phase,
+// then the config file, then FTPSCAN_* environment variables and finally the flags of
+// the command line, each one overriding the previous
+type Config struct {
+	DB       string   `toml:"db"`
+	Output   Output   `toml:"output"`
+	Scan     Scan     `toml:"scan"`
+	Explore  Explore  `toml:"explore"`
+	Index    Index    `toml:"index"`
+	Maintain Maintain `toml:"maintain"`
+}
+
+type Output struct {
+	Log     string `toml:"log"`
+	Results string `toml:"results"`
+}
+
+type Scan struct {
+	Targets         string   `toml:"targets"`
+	Exclude         []string `toml:"exclude"`
+	Blocklist       string   `toml:"blocklist"`
+	Hitlist         string   `toml:"hitlist"`
+	Explore         bool     `toml:"explore"`
+	Order           string   `toml:"order"`
+	Seed            int64    `toml:"seed"`
+	Shard           string   `toml:"shard"`
+	Ports           []int    `toml:"ports"`
+	Concurrency     int      `toml:"concurrency"`
+	QueueSize       int      `toml:"queue_size"`
+	DialTimeout     Duration `toml:"dial_timeout"`
+	Banner          bool     `toml:"banner"`
+	BannerSize      int      `toml:"banner_size"`
+	BannerTimeout   Duration `toml:"banner_timeout"`
+	Rate            float64  `toml:"rate"`
+	Rate16          float64  `toml:"rate16"`
+	Rate24          float64  `toml:"rate24"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout"`
+}
+
+type Explore struct {
+	Concurrency     int      `toml:"concurrency"`
+	QueueSize       int      `toml:"queue_size"`
+	Timeout         Duration `toml:"timeout"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout"`
+	ImplicitPorts   []int    `toml:"implicit_ports"`
+	Signatures      string   `toml:"signatures"`
+	Revisit         Duration `toml:"revisit"`
+}
+
+type Index struct {
+	Concurrency     int      `toml:"concurrency"`
+	Timeout         Duration `toml:"timeout"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout"`
+	MaxDepth        int      `toml:"max_depth"`
+	MaxEntries      int      `toml:"max_entries"`
+	MaxTime         Duration `toml:"max_time"`
+	Revisit         Duration `toml:"revisit"`
+}
+
+type Maintain struct {
+	Anonymous   Duration `toml:"anonymous"`
+	Available   Duration `toml:"available"`
+	Other       Duration `toml:"other"`
+	Unreachable Duration `toml:"unreachable"`
+	MaxBackoff  Duration `toml:"max_backoff"`
+	Budget      int      `toml:"budget"`
+}
+
+// Duration is written as "1m30s" in the config file
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) (err error) {
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// CURRENT is the configuration we're running with
+var CURRENT Config
+
+// Load reads the config file on top of the defaults in c and applies the environment.
+// A missing file is only an error when it was asked for explicitly
+func Load(c *Config, path string, explicit bool) error {
+	if path != "" {
+		md, err := toml.DecodeFile(path, c)
+		if os.IsNotExist(err) && !explicit {
+			err = nil
+		} else if err != nil {
+			return fmt.Errorf("config %s: %s", path, err.Error())
+		} else if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("config %s: unknown setting '%s'", path, undecoded[0].String())
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(c).Elem(), "FTPSCAN"); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// applyEnv overrides a setting with the FTPSCAN_<SECTION>_<NAME> variable when it's set,
+// eg: FTPSCAN_SCAN_DIAL_TIMEOUT=5s. Lists are comma separated
+func applyEnv(v reflect.Value, prefix string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		name := prefix + "_" + strings.ToUpper(field.Tag.Get("toml"))
+		if value.Kind() == reflect.Struct && field.Type != reflect.TypeOf(Duration{}) {
+			if err := applyEnv(value, name); err != nil {
+				return err
+			}
+			continue
+		}
+		str, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(value, str); err != nil {
+			return fmt.Errorf("%s: invalid value '%s'", name, str)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, str string) error {
+	switch v.Interface().(type) {
+	case Duration:
+		d, err := time.ParseDuration(str)
+		v.Set(reflect.ValueOf(Duration{d}))
+		return err
+	case []string:
+		list := []string{}
+		for _, s := range strings.Split(str, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	case []int:
+		list := []int{}
+		for _, s := range strings.Split(str, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return err
+			}
+			list = append(list, n)
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	if c.DB == "" {
+		return fmt.Errorf("db: can't be empty")
+	} else if err := c.Scan.Validate(); err != nil {
+		return err
+	} else if err := c.Explore.Validate(); err != nil {
+		return err
+	} else if err := c.Index.Validate(); err != nil {
+		return err
+	}
+	return c.Maintain.Validate()
+}
+
+func (s Scan) Validate() error {
+	var i, n int
+	switch {
+	case s.Order != "reversed" && s.Order != "random" && s.Order != "hitlist":
+		return fmt.Errorf("scan.order: '%s' isn't one of reversed or random", s.Order)
+	case strings.Count(s.Shard, "/") != 1:
+		return fmt.Errorf("scan.shard: '%s' isn't of the form i/n", s.Shard)
+	case len(s.Ports) == 0:
+		return fmt.Errorf("scan.ports: at least one port is needed")
+	case s.Concurrency < 0:
+		return fmt.Errorf("scan.concurrency: can't be negative")
+	case s.QueueSize < 1:
+		return fmt.Errorf("scan.queue_size: must be at least 1")
+	case s.DialTimeout.Duration <= 0:
+		return fmt.Errorf("scan.dial_timeout: must be positive")
+	case s.BannerSize < 4:
+		return fmt.Errorf("scan.banner_size: must be at least 4 bytes")
+	case s.BannerTimeout.Duration <= 0:
+		return fmt.Errorf("scan.banner_timeout: must be positive")
+	case s.Rate < 0 || s.Rate16 < 0 || s.Rate24 < 0:
+		return fmt.Errorf("scan.rate: can't be negative, 0 means unlimited")
+	case s.ShutdownTimeout.Duration <= 0:
+		return fmt.Errorf("scan.shutdown_timeout: must be positive")
+	}
+	if _, err := fmt.Sscanf(s.Shard, "%d/%d", &i, &n); err != nil || n < 1 || i < 0 || i >= n {
+		return fmt.Errorf("scan.shard: '%s' isn't of the form i/n with 0 <= i < n", s.Shard)
+	}
+	for _, port := range s.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("scan.ports: %d isn't a valid port", port)
+		}
+	}
+	return nil
+}
+
+func (e Explore) Validate() error {
+	switch {
+	case e.Concurrency < 1:
+		return fmt.Errorf("explore.concurrency: must be at least 1")
+	case e.QueueSize < 1:
+		return fmt.Errorf("explore.queue_size: must be at least 1")
+	case e.Timeout.Duration <= 0:
+		return fmt.Errorf("explore.timeout: must be positive")
+	case e.ShutdownTimeout.Duration <= 0:
+		return fmt.Errorf("explore.shutdown_timeout: must be positive")
+	case e.Revisit.Duration < 0:
+		return fmt.Errorf("explore.revisit: can't be negative, 0 means never")
+	}
+	for _, port := range e.ImplicitPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("explore.implicit_ports: %d isn't a valid port", port)
+		}
+	}
+	return nil
+}
+
+func (i Index) Validate() error {
+	switch {
+	case i.Concurrency < 1:
+		return fmt.Errorf("index.concurrency: must be at least 1")
+	case i.Timeout.Duration <= 0:
+		return fmt.Errorf("index.timeout: must be positive")
+	case i.ShutdownTimeout.Duration <= 0:
+		return fmt.Errorf("index.shutdown_timeout: must be positive")
+	case i.MaxDepth < 0:
+		return fmt.Errorf("index.max_depth: can't be negative, 0 lists the top directory only")
+	case i.MaxEntries < 1:
+		return fmt.Errorf("index.max_entries: must be at least 1")
+	case i.MaxTime.Duration <= 0:
+		return fmt.Errorf("index.max_time: must be positive")
+	case i.Revisit.Duration < 0:
+		return fmt.Errorf("index.revisit: can't be negative, 0 means never")
+	}
+	return nil
+}
+
+func (m Maintain) Validate() error {
+	switch {
+	case m.Anonymous.Duration <= 0 || m.Available.Duration <= 0 || m.Other.Duration <= 0:
+		return fmt.Errorf("maintain: intervals must be positive")
+	case m.Unreachable.Duration <= 0:
+		return fmt.Errorf("maintain.unreachable: must be positive")
+	case m.MaxBackoff.Duration < m.Unreachable.Duration:
+		return fmt.Errorf("maintain.max_backoff: can't be shorter than maintain.unreachable")
+	case m.Budget < 1:
+		return fmt.Errorf("maintain.budget: must be at least 1")
+	}
+	return nil
+}
+
+// Print shows the settings a phase runs with, section being what the phase ended up
+// with once its flags are parsed
+func Print(name string, section interface{}) {
+	fmt.Printf("> config:\n")
+	enc := toml.NewEncoder(os.Stdout)
+	enc.Indent = "  "
+	enc.Encode(struct {
+		DB     string `toml:"db"`
+		Output Output `toml:"output"`
+	}{CURRENT.DB, CURRENT.Output})
+	enc.Encode(map[string]interface{}{name: section})
+	fmt.Printf("\n")
+}
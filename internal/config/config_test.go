@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func defaults() Config {
+	return Config{
+		DB: "ftp.sqlite",
+		Scan: Scan{
+			Order: "reversed", Shard: "0/1", Ports: []int{21}, QueueSize: 10,
+			DialTimeout: Duration{time.Second}, BannerSize: 512, BannerTimeout: Duration{time.Second},
+			ShutdownTimeout: Duration{time.Second},
+		},
+		Explore: Explore{
+			Concurrency: 10, QueueSize: 10, Timeout: Duration{time.Second}, ShutdownTimeout: Duration{time.Second},
+		},
+		Index: Index{
+			Concurrency: 10, Timeout: Duration{time.Second}, ShutdownTimeout: Duration{time.Second},
+			MaxDepth: 10, MaxEntries: 100, MaxTime: Duration{time.Minute},
+		},
+		Maintain: Maintain{
+			Anonymous: Duration{time.Hour}, Available: Duration{time.Hour}, Other: Duration{time.Hour},
+			Unreachable: Duration{time.Hour}, MaxBackoff: Duration{time.Hour}, Budget: 10,
+		},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ftpscan.toml")
+	os.WriteFile(path, []byte(`
+db = "other.sqlite"
+
+[scan]
+ports = [21, 990]
+dial_timeout = "5s"
+exclude = ["a.txt", "b.txt"]
+
+[explore]
+concurrency = 50
+`), 0644)
+	os.Setenv("FTPSCAN_SCAN_RATE", "100")
+	os.Setenv("FTPSCAN_EXPLORE_CONCURRENCY", "20")
+	defer os.Unsetenv("FTPSCAN_SCAN_RATE")
+	defer os.Unsetenv("FTPSCAN_EXPLORE_CONCURRENCY")
+
+	c := defaults()
+	if err := Load(&c, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if c.DB != "other.sqlite" || len(c.Scan.Ports) != 2 || c.Scan.DialTimeout.Duration != 5*time.Second {
+		t.Errorf("config file wasn't applied: %+v", c)
+	}
+	if len(c.Scan.Exclude) != 2 || c.Scan.Order != "reversed" || c.Scan.BannerSize != 512 {
+		t.Errorf("defaults were lost: %+v", c.Scan)
+	}
+	if c.Scan.Rate != 100 || c.Explore.Concurrency != 20 {
+		t.Errorf("environment wasn't applied: %+v", c)
+	}
+
+	c = defaults()
+	if err := Load(&c, filepath.Join(t.TempDir(), "missing.toml"), false); err != nil {
+		t.Errorf("a missing default config file should be ignored: %v", err)
+	} else if err = Load(&c, filepath.Join(t.TempDir(), "missing.toml"), true); err == nil {
+		t.Errorf("a missing config file given explicitly should fail")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for content, want := range map[string]string{
+		"[scan]\nportz = [21]":                "unknown setting 'scan.portz'",
+		"[scan]\nports = [0]":                 "scan.ports: 0 isn't a valid port",
+		"[scan]\norder = \"zigzag\"":          "scan.order",
+		"[scan]\nshard = \"3/3\"":             "scan.shard",
+		"[scan]\ndial_timeout = \"soon\"":     "invalid duration \"soon\"",
+		"[scan]\nrate = -1":                   "scan.rate",
+		"[explore]\nconcurrency = 0":          "explore.concurrency",
+		"[explore]\nimplicit_ports = [99999]": "explore.implicit_ports: 99999 isn't a valid port",
+		"[index]\nmax_depth = -1":             "index.max_depth",
+		"[index]\nmax_time = \"0s\"":          "index.max_time",
+		"[maintain]\nmax_backoff = \"1m\"":    "maintain.max_backoff",
+		"[maintain]\nbudget = 0":              "maintain.budget",
+		"db = \"\"":                           "db: can't be empty",
+	} {
+		path := filepath.Join(t.TempDir(), "ftpscan.toml")
+		os.WriteFile(path, []byte(content), 0644)
+		c := defaults()
+		if err := Load(&c, path, true); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", content, err, want)
+		}
+	}
+
+	os.Setenv("FTPSCAN_SCAN_BANNER", "maybe")
+	defer os.Unsetenv("FTPSCAN_SCAN_BANNER")
+	c := defaults()
+	if err := Load(&c, "", false); err == nil || !strings.Contains(err.Error(), "FTPSCAN_SCAN_BANNER") {
+		t.Errorf("invalid environment variable: got error %v", err)
+	}
+}
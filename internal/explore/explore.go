@@ -0,0 +1,233 @@
+package explore
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+	"github.com/mickael-kerjean/ftpscan/internal/fingerprint"
+	"github.com/mickael-kerjean/ftpscan/internal/optout"
+	"github.com/mickael-kerjean/ftpscan/internal/shutdown"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	CONCURRENCY      int           = 1000
+	QUEUE_SIZE       int           = 25000
+	TIMEOUT          time.Duration = 1 * time.Second
+	SHUTDOWN_TIMEOUT time.Duration = 10 * time.Second
+	IMPLICIT_PORTS   []int         = []int{990}
+	REVISIT          time.Duration = 0
+	WRITER           *storage.Writer
+)
+
+// Cmd is the explore phase: find out which of the hosts we've scanned are publicly
+// available ftp servers
+func Cmd(args []string) {
+	fs := flag.NewFlagSet("explore", flag.ExitOnError)
+	fs.IntVar(&CONCURRENCY, "concurrency", CONCURRENCY, "number of hosts probed at the same time")
+	fs.DurationVar(&TIMEOUT, "timeout", TIMEOUT, "time given to connect and again to read the replies of a host")
+	fs.DurationVar(&SHUTDOWN_TIMEOUT, "shutdown-timeout", SHUTDOWN_TIMEOUT, "time given to the probes in flight when stopping")
+	fs.DurationVar(&REVISIT, "revisit", REVISIT, "explore again the hosts explored longer ago than that, 0 for never")
+	fs.StringVar(&SIGNATURES_FILE, "signatures", SIGNATURES_FILE, "file of signatures to fingerprint servers, the builtin ones when empty")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan explore [-concurrency n] [-timeout d] [-shutdown-timeout d] [-revisit d] [-signatures file]
+
+Every host found by the scan that has no details yet is probed for anonymous access,
+hosts whose banner isn't an ftp greeting are skipped. With -revisit the hosts explored
+longer ago than that are probed again.
+
+Each probe is kept in the observation table and the host gets its first_seen, last_seen
+and last_status updated, last_seen being the last time it answered.
+
+Servers announcing AUTH TLS, or not telling what they support, get a second connection
+upgraded with AUTH TLS: details.ftps is set once the handshake went through and the
+certificates they presented end up in the certificate table.
+
+Ports in implicit_ports of the [explore] settings (990 by default) expect TLS from the
+start, the handshake comes before the greeting and tls_mode is 'implicit'. Servers there
+that fail the handshake get probed as plain ftp.
+
+The software of a server is told from its greeting, SYST, FEAT, HELP and error replies
+by the signatures of internal/fingerprint/signatures.toml or those of -signatures. The
+product, version and confidence land in details and can be computed again from the stored
+conversations with: ftpscan fingerprint
+`)
+	}
+	fs.Parse(args)
+	if err := Settings().Validate(); err != nil {
+		fmt.Printf("ERR %s\n", err.Error())
+		return
+	} else if err := storage.Open(); err != nil {
+		fmt.Printf("ERR %+v", err)
+		return
+	}
+	config.Print("explore", Settings())
+	shutdown.Handle()
+	writer := storage.NewWriter()
+	if err := Start(writer); err != nil {
+		fmt.Printf("ERR %+v", err)
+		return
+	}
+	explore := "details.available IS NULL"
+	if REVISIT > 0 {
+		explore += fmt.Sprintf(" OR COALESCE(details.explored_at, '') < datetime('now', '-%d seconds')", int64(REVISIT.Seconds()))
+	}
+	// hosts whose banner is an ftp greeting go first, those which sent something else
+	// aren't ftp servers and get skipped
+	rows, err := storage.DB.Query(`SELECT host.ip, host.port FROM host
+  LEFT JOIN details ON host.ip = details.related_ip AND host.port = details.related_port
+  WHERE (`+explore+`) AND (host.banner IS NULL OR host.banner = '' OR host.banner GLOB $1)
+  ORDER BY CASE WHEN host.banner GLOB $1 THEN 0 WHEN host.banner IS NULL THEN 1 ELSE 2 END`, FTP_GREETING)
+	if err != nil {
+		fmt.Printf("ERR %+v", err)
+		return
+	}
+	for rows.Next() && !shutdown.Stopped() {
+		var ip string
+		var port int
+		rows.Scan(&ip, &port)
+		Push(net.ParseIP(ip), port)
+	}
+	rows.Close()
+	Wait()
+	if err := writer.Close(); err != nil {
+		fmt.Printf("ERR %s\n", err.Error())
+	}
+	fmt.Printf("> writes: %s\n", writer.String())
+	storage.DB.Close()
+	if shutdown.Stopped() {
+		os.Exit(1)
+	}
+}
+
+// FTP_GREETING matches the banner of an ftp server: a 1xx, 2xx or 4xx reply code
+// followed by a space or a dash
+const FTP_GREETING = "[124][0-9][0-9][ -]*"
+
+const DETAILS_UPSERT = `INSERT INTO details(
+    related_ip, related_port, available, ftps, anonymous, stream, tls_mode, tls_version, tls_cipher, explored_at
+  ) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP)
+  ON CONFLICT(related_ip, related_port) DO UPDATE SET
+    available = excluded.available, ftps = excluded.ftps,
+    anonymous = excluded.anonymous, stream = excluded.stream, tls_mode = excluded.tls_mode,
+    tls_version = excluded.tls_version, tls_cipher = excluded.tls_cipher, explored_at = excluded.explored_at`
+
+const CAPABILITY_INSERT = `INSERT OR IGNORE INTO capabilities(related_ip, related_port, name, value)
+  VALUES($1, $2, $3, $4)`
+
+const CERTIFICATE_INSERT = `INSERT OR IGNORE INTO certificate(
+    fingerprint, subject, issuer, sans, not_before, not_after, key_type, self_signed, raw
+  ) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+const HOST_CERTIFICATE_INSERT = `INSERT INTO host_certificate(related_ip, related_port, position, fingerprint)
+  VALUES($1, $2, $3, $4)`
+
+type host struct {
+	ip   net.IP
+	port int
+}
+
+func runner(h host) {
+	if optout.Contains(h.ip) {
+		return
+	}
+	addr := net.JoinHostPort(h.ip.String(), strconv.Itoa(h.port))
+	start := time.Now()
+	if isImplicit(h.port) {
+		// plain ftp servers listening there fail the handshake and get the usual probe
+		if res, err := probeImplicit(addr, TIMEOUT); res.tls != nil || isTimeout(err) {
+			insertDB(h, res, start)
+			return
+		}
+	}
+	conn, err := net.DialTimeout("tcp", addr, TIMEOUT)
+	if err != nil {
+		fmt.Printf("%v => %+v\n", addr, err)
+		insertDB(h, probeResult{content: err.Error()}, start)
+		return
+	}
+	res, _ := probe(conn, TIMEOUT)
+	conn.Close()
+	if res.mightTLS() {
+		res.tls, _ = probeTLS(addr, TIMEOUT)
+	}
+	insertDB(h, res, start)
+}
+
+func (res probeResult) outcome() string {
+	switch {
+	case !res.connected:
+		return storage.OUTCOME_UNREACHABLE
+	case !res.available:
+		return storage.OUTCOME_UNAVAILABLE
+	case res.anonymous:
+		return storage.OUTCOME_ANONYMOUS
+	}
+	return storage.OUTCOME_AVAILABLE
+}
+
+func insertDB(h host, res probeResult, start time.Time) {
+	var mode, version, cipher sql.NullString
+	if res.tls != nil {
+		mode = sql.NullString{String: res.tls.mode, Valid: true}
+		version = sql.NullString{String: res.tls.version, Valid: true}
+		cipher = sql.NullString{String: res.tls.cipher, Valid: true}
+	}
+	WRITER.Write(
+		DETAILS_UPSERT, h.ip.String(), h.port, res.available, res.tls != nil, res.anonymous, res.content,
+		mode, version, cipher,
+	)
+	m := fingerprint.Match{}
+	if res.available {
+		m = identify(res.content)
+	}
+	WRITER.Write(FINGERPRINT_UPDATE, nullString(m.Product), nullString(m.Version), m.Confidence, h.ip.String(), h.port)
+	insertCapabilities(h, res.capabilities)
+	insertCertificates(h, res.tls)
+	// the summary is what we know of the software, or else the first thing we were told
+	summary := strings.TrimSpace(m.Product + " " + m.Version)
+	if summary == "" {
+		summary = strings.SplitN(res.content, "\n", 2)[0]
+	}
+	WRITER.Observe(h.ip.String(), h.port, "explore", res.outcome(), start, summary)
+	storage.Emit("explore", map[string]interface{}{
+		"ip": h.ip.String(), "port": h.port, "available": res.available, "ftps": res.tls != nil,
+		"anonymous": res.anonymous, "tls_mode": mode.String, "tls_version": version.String, "tls_cipher": cipher.String,
+		"product": m.Product, "version": m.Version, "confidence": m.Confidence,
+	})
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// insertCapabilities replaces what we knew of the features of a host
+func insertCapabilities(h host, caps []capability) {
+	WRITER.Write("DELETE FROM capabilities WHERE related_ip = $1 AND related_port = $2", h.ip.String(), h.port)
+	for _, c := range caps {
+		WRITER.Write(CAPABILITY_INSERT, h.ip.String(), h.port, c.name, c.value)
+	}
+}
+
+// insertCertificates keeps the chain a host presented, certificates are shared by every
+// host presenting them
+func insertCertificates(h host, t *tlsResult) {
+	WRITER.Write("DELETE FROM host_certificate WHERE related_ip = $1 AND related_port = $2", h.ip.String(), h.port)
+	if t == nil {
+		return
+	}
+	for i, c := range t.chain {
+		WRITER.Write(
+			CERTIFICATE_INSERT, c.fingerprint, c.subject, c.issuer, strings.Join(c.sans, ","),
+			c.notBefore, c.notAfter, c.keyType, c.selfSigned, c.raw,
+		)
+		WRITER.Write(HOST_CERTIFICATE_INSERT, h.ip.String(), h.port, i, c.fingerprint)
+	}
+}
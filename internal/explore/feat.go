@@ -0,0 +1,70 @@
+package explore
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/ftp"
+	"strings"
+)
+
+type capability struct {
+	name  string
+	value string
+}
+
+// parseFeatures turns the reply of FEAT into capabilities. Names are upper cased and the
+// features that come with a list get one capability per item without the '*' marking
+// what's enabled, eg: "MLST type*;size*;" gives MLST type and MLST size
+func parseFeatures(rep ftp.Reply) []capability {
+	caps := []capability{}
+	if rep.Code != 211 {
+		return caps
+	}
+	seen := map[capability]bool{}
+	// RFC 2389 has one feature per line between the first and the last line of the reply
+	for i := 1; i < len(rep.Lines)-1; i++ {
+		fields := strings.Fields(rep.Lines[i])
+		if len(fields) == 0 {
+			continue
+		}
+		name, rest := strings.ToUpper(fields[0]), strings.Join(fields[1:], " ")
+		values := []string{rest}
+		switch name {
+		case "AUTH":
+			values = splitList(strings.ToUpper(rest), "; ")
+		case "HASH":
+			values = splitList(strings.ToUpper(rest), ";")
+		case "LANG", "MLST":
+			values = splitList(strings.ToLower(rest), ";")
+		case "REST", "PROT", "PBSZ":
+			values = []string{strings.ToUpper(rest)}
+		}
+		for _, value := range values {
+			c := capability{name, value}
+			if !seen[c] {
+				seen[c] = true
+				caps = append(caps, c)
+			}
+		}
+	}
+	return caps
+}
+
+func splitList(str string, separators string) []string {
+	list := []string{}
+	for _, item := range strings.FieldsFunc(str, func(r rune) bool { return strings.ContainsRune(separators, r) }) {
+		list = append(list, strings.TrimSuffix(item, "*"))
+	}
+	if len(list) == 0 {
+		list = append(list, "")
+	}
+	return list
+}
+
+// hasCapability tells if one of the capabilities has the given name and value
+func hasCapability(caps []capability, name string, value string) bool {
+	for _, c := range caps {
+		if c.name == name && c.value == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package explore
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/fingerprint"
+	"github.com/mickael-kerjean/ftpscan/internal/ftp"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"strings"
+)
+
+var (
+	SIGNATURES_FILE string = ""
+	SIGNATURES      []fingerprint.Signature
+)
+
+const FINGERPRINT_UPDATE = `UPDATE details SET product = $1, version = $2, confidence = $3
+  WHERE related_ip = $4 AND related_port = $5`
+
+// conversation splits a transcript into what signatures look at. We go by reply codes
+// rather than by the commands we sent so transcripts stored by older versions, which
+// didn't wait for a reply before the next command, work just as well
+func conversation(transcript string) fingerprint.Conversation {
+	c := fingerprint.Conversation{}
+	r := bufio.NewReader(strings.NewReader(transcript + "\n"))
+	errors, greeted := []string{}, false
+	for {
+		rep, _ := ftp.ReadReply(r)
+		if len(rep.Lines) == 0 {
+			break
+		} else if rep.Code == 0 {
+			// what isn't a reply, blank lines included, is skipped
+			continue
+		}
+		text := strings.Join(rep.Lines, "\n")
+		switch {
+		case !greeted:
+			// a 120 comes before the actual greeting
+			c.Banner = strings.TrimPrefix(c.Banner+"\n"+text, "\n")
+			greeted = rep.Code >= 200
+		case rep.Code == 215:
+			c.Syst = text
+		case rep.Code == 211 && len(rep.Lines) > 1:
+			features := []string{}
+			for _, line := range rep.Lines[1 : len(rep.Lines)-1] {
+				features = append(features, strings.TrimSpace(line))
+			}
+			c.Feat = strings.Join(features, "\n")
+		case rep.Code == 214:
+			c.Help = text
+		case rep.Code >= 400:
+			errors = append(errors, text)
+		}
+	}
+	c.Errors = strings.Join(errors, "\n")
+	return c
+}
+
+func identify(transcript string) fingerprint.Match {
+	if transcript == "" {
+		return fingerprint.Match{}
+	}
+	return fingerprint.Identify(SIGNATURES, conversation(transcript))
+}
+
+// FingerprintCmd runs the signatures over the transcripts we've stored, to pick up new
+// or updated signatures without probing anybody again
+func FingerprintCmd(args []string) {
+	fs := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	fs.StringVar(&SIGNATURES_FILE, "signatures", SIGNATURES_FILE, "file of signatures, the builtin ones when empty")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan fingerprint [-signatures file]
+
+The product, version and confidence of every host explored so far are computed again from
+the conversation stored in details.stream.
+`)
+	}
+	fs.Parse(args)
+	var err error
+	if SIGNATURES, err = fingerprint.Load(SIGNATURES_FILE); err != nil {
+		fmt.Printf("ERR %s\n", err.Error())
+		return
+	} else if err = storage.Open(); err != nil {
+		fmt.Printf("ERR %s\n", err.Error())
+		return
+	}
+	defer storage.DB.Close()
+	rows, err := storage.DB.Query("SELECT related_ip, related_port, stream FROM details WHERE available = 1")
+	if err != nil {
+		fmt.Printf("ERR %s\n", err.Error())
+		return
+	}
+	writer := storage.NewWriter()
+	total, identified := 0, 0
+	for rows.Next() {
+		var ip, stream string
+		var port int
+		if err = rows.Scan(&ip, &port, &stream); err != nil {
+			break
+		}
+		m := identify(stream)
+		writer.Write(FINGERPRINT_UPDATE, nullString(m.Product), nullString(m.Version), m.Confidence, ip, port)
+		if total++; m.Product != "" {
+			identified++
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		fmt.Printf("ERR %s\n", err.Error())
+	}
+	if err := writer.Close(); err != nil {
+		fmt.Printf("ERR %s\n", err.Error())
+	}
+	fmt.Printf("> %d hosts fingerprinted, %d identified\n", total, identified)
+}
@@ -0,0 +1,38 @@
+package explore
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/fingerprint"
+	"testing"
+)
+
+func TestConversation(t *testing.T) {
+	for _, tc := range []struct {
+		transcript string
+		want       fingerprint.Conversation
+	}{
+		{
+			"220 (vsFTPd 3.0.3)\n331 Please specify the password.\n530 Login incorrect.\n215 UNIX Type: L8\n" +
+				"211-Features:\n EPRT\n EPSV\n MDTM\n211 End\n214-The following commands are recognized.\n ABOR ACCT\n214 Help OK.\n221 Goodbye.",
+			fingerprint.Conversation{
+				Banner: "220 (vsFTPd 3.0.3)",
+				Syst:   "215 UNIX Type: L8",
+				Feat:   "EPRT\nEPSV\nMDTM",
+				Help:   "214-The following commands are recognized.\n ABOR ACCT\n214 Help OK.",
+				Errors: "530 Login incorrect.",
+			},
+		},
+		// stored before we waited for each reply, with blank lines and junk in between
+		{
+			"120 in a minute\n220-Welcome\n220 ready\n\n530 Login incorrect.\nnot a reply\n500 SYST not understood\n500 FEAT not understood\n",
+			fingerprint.Conversation{
+				Banner: "120 in a minute\n220-Welcome\n220 ready",
+				Errors: "530 Login incorrect.\n500 SYST not understood\n500 FEAT not understood",
+			},
+		},
+		{"", fingerprint.Conversation{}},
+	} {
+		if got := conversation(tc.transcript); got != tc.want {
+			t.Errorf("conversation(%q) = %+v\nwant %+v", tc.transcript, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package explore
+
+import (
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/ftp"
+	"net"
+	"strings"
+	"time"
+)
+
+type probeResult struct {
+	connected    bool
+	available    bool
+	anonymous    bool
+	capabilities []capability
+	features     bool
+	content      string
+	tls          *tlsResult
+}
+
+// probe goes through the greeting and an anonymous login before asking what the server
+// supports and for its help. A server is available once it greets us with a 220, what it
+// answered is kept in content even when the conversation ends early
+func probe(conn net.Conn, timeout time.Duration) (res probeResult, err error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	s := ftp.NewSession(conn)
+	res.connected = true
+	defer func() { res.content = strings.Join(s.Transcript, "\n") }()
+
+	rep, err := s.Read()
+	if err != nil {
+		return res, err
+	} else if rep.Code != 220 {
+		return res, fmt.Errorf("unexpected greeting '%s'", rep.Lines[0])
+	}
+	res.available = true
+	if res.anonymous, err = s.Login(); err != nil {
+		return res, err
+	} else if _, err = s.Cmd("SYST"); err != nil {
+		return res, err
+	} else if rep, err = s.Cmd("FEAT"); err != nil {
+		return res, err
+	}
+	res.features = rep.Code == 211
+	res.capabilities = parseFeatures(rep)
+	// HELP is only there for the fingerprint, how it's worded tells servers apart
+	if _, err = s.Cmd("HELP"); err != nil {
+		return res, nil
+	}
+	s.Cmd("QUIT")
+	return res, nil
+}
+
+// mightTLS tells if a server is worth an AUTH TLS: it either announced it or didn't
+// tell us what it supports
+func (res probeResult) mightTLS() bool {
+	return res.available && (!res.features ||
+		hasCapability(res.capabilities, "AUTH", "TLS") || hasCapability(res.capabilities, "AUTH", "SSL"))
+}
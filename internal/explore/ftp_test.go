@@ -0,0 +1,143 @@
+package explore
+
+import (
+	"bufio"
+	"github.com/mickael-kerjean/ftpscan/internal/ftp"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve answers every command with the reply of the script, a command sent before the
+// previous reply is out makes the server drop the connection the way some servers do
+func serve(t *testing.T, greeting string, script map[string]string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte(greeting))
+		r := bufio.NewReader(c)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || r.Buffered() > 0 {
+				return
+			}
+			rep, ok := script[strings.TrimSpace(line)]
+			if !ok {
+				rep = "502 not implemented\r\n"
+			}
+			// replies come in pieces
+			for _, part := range []string{rep[:len(rep)/2], rep[len(rep)/2:]} {
+				c.Write([]byte(part))
+				time.Sleep(5 * time.Millisecond)
+			}
+			if strings.HasPrefix(rep, "421") || strings.TrimSpace(line) == "QUIT" {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func TestProbe(t *testing.T) {
+	feat := "211-Features:\r\n MDTM\r\n AUTH TLS\r\n UTF8\r\n211 End\r\n"
+	for _, tc := range []struct {
+		name     string
+		greeting string
+		script   map[string]string
+		want     probeResult
+		tls      bool
+		err      bool
+	}{
+		{"password", "220 ready\r\n", map[string]string{
+			"USER anonymous": "331 password please\r\n",
+			"PASS anonymous": "230-Welcome\r\n230-be nice\r\n230 logged in\r\n",
+			"SYST":           "215 UNIX Type: L8\r\n",
+			"FEAT":           feat,
+			"QUIT":           "221 bye\r\n",
+		}, probeResult{connected: true, available: true, anonymous: true, features: true}, true, false},
+		{"no password", "120 wait a bit\r\n220 ready\r\n", map[string]string{
+			"USER anonymous": "230 come in\r\n",
+			"FEAT":           "211 no features\r\n",
+		}, probeResult{connected: true, available: true, anonymous: true, features: true}, false, false},
+		{"rejected", "220-hello\r\n220 ready\r\n", map[string]string{
+			"USER anonymous": "331 password please\r\n",
+			"PASS anonymous": "530 Login incorrect.\r\n",
+			"FEAT":           feat,
+		}, probeResult{connected: true, available: true, anonymous: false, features: true}, true, false},
+		{"no anonymous user", "220 ready\r\n", map[string]string{
+			"USER anonymous": "530 go away\r\n",
+		}, probeResult{connected: true, available: true, anonymous: false, features: false}, true, false},
+		{"closing", "220 ready\r\n", map[string]string{
+			"USER anonymous": "421 too many users\r\n",
+		}, probeResult{connected: true, available: true, anonymous: false, features: false}, true, true},
+		{"busy", "421 too many users\r\n", nil, probeResult{connected: true, available: false, anonymous: false, features: false}, false, true},
+		{"not ftp", "SSH-2.0-OpenSSH_8.9\r\n", nil, probeResult{connected: true, available: false, anonymous: false, features: false}, false, true},
+	} {
+		conn, err := net.Dial("tcp", serve(t, tc.greeting, tc.script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := probe(conn, time.Second)
+		conn.Close()
+		if got.content == "" {
+			t.Errorf("%s: nothing kept from the conversation", tc.name)
+		}
+		if got.mightTLS() != tc.tls {
+			t.Errorf("%s: mightTLS = %v", tc.name, got.mightTLS())
+		}
+		got.content, got.capabilities = "", nil
+		if !reflect.DeepEqual(got, tc.want) || (err != nil) != tc.err {
+			t.Errorf("%s: probe = %+v %v, want %+v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	rep := ftp.Reply{Code: 211, Lines: []string{
+		"211-Features:",
+		" AUTH TLS;SSL",
+		" auth TLS",
+		" PBSZ",
+		" PROT",
+		" UTF8",
+		" MLST type*;size*;Modify*;perm;",
+		" MLSD",
+		" EPSV",
+		" EPRT",
+		" SIZE",
+		" MDTM",
+		" REST STREAM",
+		" HASH SHA-1;SHA-256*;MD5",
+		" HOST",
+		" LANG EN*;FR",
+		"",
+		" CLNT",
+		"211 End",
+	}}
+	want := []capability{
+		{"AUTH", "TLS"}, {"AUTH", "SSL"}, {"PBSZ", ""}, {"PROT", ""}, {"UTF8", ""},
+		{"MLST", "type"}, {"MLST", "size"}, {"MLST", "modify"}, {"MLST", "perm"},
+		{"MLSD", ""}, {"EPSV", ""}, {"EPRT", ""}, {"SIZE", ""}, {"MDTM", ""}, {"REST", "STREAM"},
+		{"HASH", "SHA-1"}, {"HASH", "SHA-256"}, {"HASH", "MD5"}, {"HOST", ""},
+		{"LANG", "en"}, {"LANG", "fr"}, {"CLNT", ""},
+	}
+	if got := parseFeatures(rep); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFeatures = %v\nwant %v", got, want)
+	}
+	if got := parseFeatures(ftp.Reply{Code: 500, Lines: []string{"500 FEAT not understood"}}); len(got) != 0 {
+		t.Errorf("parseFeatures of an error = %v", got)
+	}
+	if got := parseFeatures(ftp.Reply{Code: 211, Lines: []string{"211 no features"}}); len(got) != 0 {
+		t.Errorf("parseFeatures without features = %v", got)
+	}
+}
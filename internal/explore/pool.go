@@ -0,0 +1,65 @@
+package explore
+
+import (
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/fingerprint"
+	"github.com/mickael-kerjean/ftpscan/internal/optout"
+	"github.com/mickael-kerjean/ftpscan/internal/shutdown"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"sync"
+)
+
+var (
+	queue chan host
+	wg    sync.WaitGroup
+)
+
+// Start runs the workers of the explore phase on the hosts handed over with Push. The scan
+// uses it to explore hosts as soon as they're found, sharing its writer so the details of
+// a host are never committed before the host itself
+func Start(w *storage.Writer) (err error) {
+	if err = optout.Load(); err != nil {
+		return err
+	} else if SIGNATURES, err = fingerprint.Load(SIGNATURES_FILE); err != nil {
+		return err
+	}
+	optout.Watch()
+	WRITER = w
+	queue = make(chan host, QUEUE_SIZE)
+	for i := 0; i < CONCURRENCY; i++ {
+		wg.Add(1)
+		go func() {
+			for h := range queue {
+				// hosts left in the queue have no details yet, the next explore picks them up
+				if shutdown.Stopped() {
+					continue
+				}
+				runner(h)
+			}
+			wg.Done()
+		}()
+	}
+	return nil
+}
+
+// Push hands a host over to the workers. It blocks while the queue is full so whoever
+// feeds us can't get further ahead than QUEUE_SIZE hosts
+func Push(ip net.IP, port int) {
+	if optout.Contains(ip) {
+		return
+	}
+	select {
+	case queue <- host{ip, port}:
+	case <-shutdown.STOP:
+	}
+}
+
+// Wait lets the workers go through what's left in the queue, they're only given
+// SHUTDOWN_TIMEOUT once we're asked to stop
+func Wait() {
+	close(queue)
+	if !shutdown.Wait(&wg, SHUTDOWN_TIMEOUT) {
+		fmt.Printf("> gave up on the hosts still being probed after %s\n", SHUTDOWN_TIMEOUT)
+	}
+}
@@ -0,0 +1,65 @@
+package explore
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPoolDrains(t *testing.T) {
+	defer func(path string) { storage.PATH = path }(storage.PATH)
+	storage.PATH = filepath.Join(t.TempDir(), "ftp.sqlite")
+	if err := storage.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.DB.Close()
+	defer func(concurrency, size int, timeout, shutdown time.Duration) {
+		CONCURRENCY, QUEUE_SIZE, TIMEOUT, SHUTDOWN_TIMEOUT = concurrency, size, timeout, shutdown
+	}(CONCURRENCY, QUEUE_SIZE, TIMEOUT, SHUTDOWN_TIMEOUT)
+	// the queue takes a lot longer than the shutdown timeout to go through, which is only
+	// there for when we're asked to stop
+	CONCURRENCY, QUEUE_SIZE, TIMEOUT, SHUTDOWN_TIMEOUT = 2, 10, 100*time.Millisecond, time.Millisecond
+
+	// servers that never say a word
+	ports := []int{}
+	for i := 0; i < 6; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go func() {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+			}
+		}()
+		port := l.Addr().(*net.TCPAddr).Port
+		if _, err = storage.DB.Exec("INSERT INTO host(ip, port) VALUES('127.0.0.1', $1)", port); err != nil {
+			t.Fatal(err)
+		}
+		ports = append(ports, port)
+	}
+
+	w := storage.NewWriter()
+	if err := Start(w); err != nil {
+		t.Fatal(err)
+	}
+	for _, port := range ports {
+		Push(net.ParseIP("127.0.0.1"), port)
+	}
+	Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	storage.DB.QueryRow("SELECT COUNT(*) FROM details WHERE available = 0").Scan(&n)
+	if n != len(ports) {
+		t.Errorf("%d hosts explored out of %d, %s", n, len(ports), w.String())
+	}
+}
@@ -0,0 +1,25 @@
+package explore
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+)
+
+// Settings gives the current settings of the explore phase
+func Settings() config.Explore {
+	return config.Explore{
+		Concurrency:     CONCURRENCY,
+		QueueSize:       QUEUE_SIZE,
+		Timeout:         config.Duration{Duration: TIMEOUT},
+		ShutdownTimeout: config.Duration{Duration: SHUTDOWN_TIMEOUT},
+		ImplicitPorts:   IMPLICIT_PORTS,
+		Signatures:      SIGNATURES_FILE,
+		Revisit:         config.Duration{Duration: REVISIT},
+	}
+}
+
+// Configure applies the settings of the config file, the flags have the last word
+func Configure(c config.Explore) {
+	CONCURRENCY, QUEUE_SIZE = c.Concurrency, c.QueueSize
+	TIMEOUT, SHUTDOWN_TIMEOUT = c.Timeout.Duration, c.ShutdownTimeout.Duration
+	IMPLICIT_PORTS, SIGNATURES_FILE, REVISIT = c.ImplicitPorts, c.Signatures, c.Revisit.Duration
+}
@@ -0,0 +1,160 @@
+package explore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/ftp"
+	"net"
+	"strings"
+	"time"
+)
+
+type tlsResult struct {
+	mode    string
+	version string
+	cipher  string
+	chain   []certificate
+}
+
+type certificate struct {
+	fingerprint string
+	subject     string
+	issuer      string
+	sans        []string
+	notBefore   time.Time
+	notAfter    time.Time
+	keyType     string
+	selfSigned  bool
+	raw         []byte
+}
+
+var TLS_VERSIONS = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// probeTLS upgrades a new control connection with AUTH TLS (RFC 4217) and keeps what was
+// negotiated along with the certificates the server sent. It has a connection of its own
+// as a failed handshake leaves the control connection unusable
+func probeTLS(addr string, timeout time.Duration) (*tlsResult, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	s := ftp.NewSession(conn)
+	if rep, err := s.Read(); err != nil {
+		return nil, err
+	} else if rep.Code != 220 {
+		return nil, fmt.Errorf("unexpected greeting '%s'", rep.Lines[0])
+	}
+	if rep, err := s.Cmd("AUTH TLS"); err != nil {
+		return nil, err
+	} else if rep.Code != 234 {
+		return nil, fmt.Errorf("AUTH TLS refused: %s", rep.Lines[0])
+	}
+	tconn, res, err := handshake(conn, addr, "explicit")
+	if err != nil {
+		return nil, err
+	}
+	ftp.NewSession(tconn).Cmd("QUIT")
+	return res, nil
+}
+
+// handshake runs the client side of TLS over conn, the conversation carries on over the
+// connection it gives back
+func handshake(conn net.Conn, addr string, mode string) (*tls.Conn, *tlsResult, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	tconn := tls.Client(conn, ftp.TLSConfig(host))
+	if err := tconn.Handshake(); err != nil {
+		return nil, nil, err
+	}
+	state := tconn.ConnectionState()
+	res := &tlsResult{
+		mode:    mode,
+		version: TLS_VERSIONS[state.Version],
+		cipher:  tls.CipherSuiteName(state.CipherSuite),
+	}
+	for _, c := range state.PeerCertificates {
+		res.chain = append(res.chain, newCertificate(c))
+	}
+	return tconn, res, nil
+}
+
+// probeImplicit is the probe of a server expecting TLS from the start (implicit FTPS,
+// port 990), the greeting comes once the handshake is done
+func probeImplicit(addr string, timeout time.Duration) (probeResult, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return probeResult{content: err.Error()}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	tconn, t, err := handshake(conn, addr, "implicit")
+	if err != nil {
+		return probeResult{connected: true, content: err.Error()}, err
+	}
+	res, err := probe(tconn, timeout)
+	res.tls = t
+	return res, err
+}
+
+func isImplicit(port int) bool {
+	for _, p := range IMPLICIT_PORTS {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+func newCertificate(c *x509.Certificate) certificate {
+	sum := sha256.Sum256(c.Raw)
+	sans := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, c.EmailAddresses...)
+	for _, uri := range c.URIs {
+		sans = append(sans, uri.String())
+	}
+	return certificate{
+		fingerprint: hex.EncodeToString(sum[:]),
+		subject:     c.Subject.String(),
+		issuer:      c.Issuer.String(),
+		sans:        sans,
+		notBefore:   c.NotBefore.UTC(),
+		notAfter:    c.NotAfter.UTC(),
+		keyType:     keyType(c),
+		selfSigned:  bytes.Equal(c.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(c) == nil,
+		raw:         c.Raw,
+	}
+}
+
+// keyType gives the algorithm of the public key with its size, eg: RSA-2048, ECDSA-P-256
+func keyType(c *x509.Certificate) string {
+	switch key := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return strings.ToUpper(c.PublicKeyAlgorithm.String())
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
@@ -0,0 +1,164 @@
+package explore
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTLSConfig has the chain of a certificate signed by an authority of its own
+func testTLSConfig(t *testing.T) *tls.Config {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ftp.example.com", Organization: []string{"Example"}},
+		NotBefore:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC),
+		DNSNames:     []string{"ftp.example.com", "example.com"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leafDER, caDER}, PrivateKey: key}}}
+}
+
+// serveTLS is an ftp server upgrading the control connection on AUTH TLS
+func serveTLS(t *testing.T, auth string) string {
+	config := testTLSConfig(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("220 ready\r\n"))
+		line, err := bufio.NewReader(c).ReadString('\n')
+		if err != nil || strings.TrimSpace(line) != "AUTH TLS" {
+			return
+		}
+		c.Write([]byte(auth))
+		if !strings.HasPrefix(auth, "234") {
+			return
+		}
+		tc := tls.Server(c, config)
+		if line, err = bufio.NewReader(tc).ReadString('\n'); err == nil && strings.TrimSpace(line) == "QUIT" {
+			tc.Write([]byte("221 bye\r\n"))
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func TestProbeTLS(t *testing.T) {
+	res, err := probeTLS(serveTLS(t, "234 AUTH TLS successful\r\n"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.mode != "explicit" || res.version != "TLS 1.3" || res.cipher == "" {
+		t.Errorf("negotiated %q %q %q", res.mode, res.version, res.cipher)
+	}
+	if len(res.chain) != 2 {
+		t.Fatalf("chain of %d certificates", len(res.chain))
+	}
+	leaf, ca := res.chain[0], res.chain[1]
+	if leaf.subject != "CN=ftp.example.com,O=Example" || leaf.issuer != "CN=Test CA" {
+		t.Errorf("leaf subject %q issuer %q", leaf.subject, leaf.issuer)
+	}
+	if want := []string{"ftp.example.com", "example.com", "127.0.0.1"}; !reflect.DeepEqual(leaf.sans, want) {
+		t.Errorf("leaf sans %q, want %q", leaf.sans, want)
+	}
+	if !leaf.notBefore.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)) || !leaf.notAfter.Equal(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("leaf validity %s - %s", leaf.notBefore, leaf.notAfter)
+	}
+	if leaf.keyType != "RSA-2048" || ca.keyType != "ECDSA-P-256" {
+		t.Errorf("key types %q %q", leaf.keyType, ca.keyType)
+	}
+	if leaf.selfSigned || !ca.selfSigned {
+		t.Errorf("self signed: leaf %v, ca %v", leaf.selfSigned, ca.selfSigned)
+	}
+	if len(leaf.fingerprint) != 64 || leaf.fingerprint == ca.fingerprint {
+		t.Errorf("fingerprints %q %q", leaf.fingerprint, ca.fingerprint)
+	}
+
+	if _, err := probeTLS(serveTLS(t, "500 AUTH not understood\r\n"), time.Second); err == nil {
+		t.Errorf("AUTH TLS refused but no error")
+	}
+}
+
+// serveImplicit is an implicit ftps server, it only greets once the handshake is done
+func serveImplicit(t *testing.T) string {
+	config := testTLSConfig(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		tc := tls.Server(c, config)
+		tc.Write([]byte("220 secure ready\r\n"))
+		r := bufio.NewReader(tc)
+		for _, rep := range []string{"331 password please\r\n", "230 logged in\r\n", "215 UNIX\r\n", "211-Features:\r\n PBSZ\r\n PROT\r\n211 End\r\n", "214 Help OK.\r\n", "221 bye\r\n"} {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+			tc.Write([]byte(rep))
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func TestProbeImplicit(t *testing.T) {
+	res, err := probeImplicit(serveImplicit(t), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.available || !res.anonymous || res.tls == nil || res.tls.mode != "implicit" || len(res.tls.chain) != 2 {
+		t.Errorf("probeImplicit = %+v %+v", res, res.tls)
+	}
+	if !hasCapability(res.capabilities, "PBSZ", "") {
+		t.Errorf("capabilities %v", res.capabilities)
+	}
+
+	// a plain ftp server where we expected implicit ftps
+	res, err = probeImplicit(serve(t, "220 plain\r\n", nil), time.Second)
+	if err == nil || res.tls != nil || isTimeout(err) {
+		t.Errorf("plain server: %+v %v", res, err)
+	}
+}
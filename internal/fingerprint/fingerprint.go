@@ -0,0 +1,133 @@
+package fingerprint
+
+import (
+	_ "embed"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// BUILTIN are the signatures we ship with, used unless another file is given
+//
+//go:embed signatures.toml
+var BUILTIN []byte
+
+var FIELDS = map[string]bool{"banner": true, "syst": true, "feat": true, "help": true, "errors": true}
+
+// Conversation is what a server told us, split the way signatures look at it
+type Conversation struct {
+	Banner string
+	Syst   string
+	Feat   string
+	Help   string
+	Errors string
+}
+
+func (c Conversation) field(name string) string {
+	switch name {
+	case "banner":
+		return c.Banner
+	case "syst":
+		return c.Syst
+	case "feat":
+		return c.Feat
+	case "help":
+		return c.Help
+	}
+	return c.Errors
+}
+
+type Signature struct {
+	Product string `toml:"product"`
+	Rules   []Rule `toml:"rule"`
+}
+
+type Rule struct {
+	Field   string  `toml:"field"`
+	Pattern string  `toml:"pattern"`
+	Weight  float64 `toml:"weight"`
+	Version int     `toml:"version"`
+	re      *regexp.Regexp
+}
+
+// Match is the product we think a server runs, Confidence goes from 0 to 1
+type Match struct {
+	Product    string
+	Version    string
+	Confidence float64
+}
+
+// Load reads the signatures of a file, the builtin ones when path is empty
+func Load(path string) ([]Signature, error) {
+	data := BUILTIN
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+	sigs, err := Parse(data)
+	if err != nil && path != "" {
+		return nil, fmt.Errorf("signatures %s: %s", path, err.Error())
+	}
+	return sigs, err
+}
+
+func Parse(data []byte) ([]Signature, error) {
+	var file struct {
+		Signatures []Signature `toml:"signature"`
+	}
+	md, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return nil, err
+	} else if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown setting '%s'", undecoded[0].String())
+	}
+	for _, sig := range file.Signatures {
+		if sig.Product == "" {
+			return nil, fmt.Errorf("signature without a product")
+		}
+		for i := range sig.Rules {
+			r := &sig.Rules[i]
+			if r.re, err = regexp.Compile("(?m)" + r.Pattern); err != nil {
+				return nil, fmt.Errorf("%s: %s", sig.Product, err.Error())
+			}
+			switch {
+			case !FIELDS[r.Field]:
+				return nil, fmt.Errorf("%s: unknown field '%s'", sig.Product, r.Field)
+			case r.Weight <= 0 || r.Weight > 1:
+				return nil, fmt.Errorf("%s: weight of '%s' isn't between 0 and 1", sig.Product, r.Pattern)
+			case r.Version < 0 || r.Version > r.re.NumSubexp():
+				return nil, fmt.Errorf("%s: '%s' has no group %d for the version", sig.Product, r.Pattern, r.Version)
+			}
+		}
+	}
+	return file.Signatures, nil
+}
+
+// Identify gives the signature we're the most confident about, the first one wins a tie
+func Identify(sigs []Signature, c Conversation) Match {
+	best := Match{}
+	for _, sig := range sigs {
+		m := Match{Product: sig.Product}
+		miss := 1.0
+		for _, r := range sig.Rules {
+			found := r.re.FindStringSubmatch(c.field(r.Field))
+			if found == nil {
+				continue
+			}
+			miss *= 1 - r.Weight
+			if m.Version == "" && r.Version > 0 {
+				m.Version = strings.TrimSpace(found[r.Version])
+			}
+		}
+		if m.Confidence = math.Round((1-miss)*1000) / 1000; m.Confidence > best.Confidence {
+			best = m
+		}
+	}
+	return best
+}
@@ -0,0 +1,88 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIdentify(t *testing.T) {
+	sigs, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		c       Conversation
+		product string
+		version string
+	}{
+		{Conversation{Banner: "220 (vsFTPd 3.0.3)"}, "vsftpd", "3.0.3"},
+		{Conversation{Banner: "220 ready", Help: "214-The following commands are recognized.\n ABOR ACCT\n214 Help OK.", Errors: "530 Please login with USER and PASS."}, "vsftpd", ""},
+		{Conversation{Banner: "220 ProFTPD 1.3.5e Server (Debian) [::ffff:10.0.0.1]"}, "ProFTPD", "1.3.5e"},
+		{Conversation{Banner: "220 ProFTPD Server (ProFTPD) [10.0.0.1]"}, "ProFTPD", ""},
+		{Conversation{Banner: "220-------- Welcome to Pure-FTPd [privsep] [TLS] ----------\n220-You are user number 1 of 50 allowed.\n220 This is a private system"}, "Pure-FTPd", ""},
+		{Conversation{Banner: "220-FileZilla Server 0.9.60 beta\n220 Please visit https://filezilla-project.org/"}, "FileZilla Server", "0.9.60 beta"},
+		{Conversation{Banner: "220 Welcome", Syst: "215 UNIX emulated by FileZilla"}, "FileZilla Server", ""},
+		{Conversation{Banner: "220 Microsoft FTP Service", Syst: "215 Windows_NT", Feat: "LANG EN*\nUTF8\nAUTH TLS;TLS-C;SSL;TLS-P;"}, "Microsoft IIS FTP", ""},
+		{Conversation{Banner: "220 Serv-U FTP Server v15.1 ready..."}, "Serv-U", "15.1"},
+		{Conversation{Banner: "220 ftp.example.org FTP server (Version wu-2.6.2(1)) ready."}, "wu-ftpd", "2.6.2(1)"},
+		{Conversation{Banner: "220 NASFTPD Turbo station 1.3.5a Server (ProFTPD) [10.0.0.1]"}, "QNAP Turbo NAS", "1.3.5a"},
+		{Conversation{Banner: "220 DiskStation Synology FTP server ready."}, "Synology DSM", ""},
+		{Conversation{Banner: "220 router FTP server (MikroTik 6.48.6) ready"}, "MikroTik RouterOS", "6.48.6"},
+		{Conversation{Banner: "220 FRITZ!Box7590 FTP server ready."}, "AVM FRITZ!Box", ""},
+		{Conversation{Banner: "220 Welcome to my server"}, "", ""},
+		{Conversation{}, "", ""},
+	} {
+		m := Identify(sigs, tc.c)
+		if m.Product != tc.product || m.Version != tc.version {
+			t.Errorf("Identify(%q) = %+v, want %s %s", tc.c.Banner, m, tc.product, tc.version)
+		} else if (m.Product != "") != (m.Confidence > 0) || m.Confidence > 1 {
+			t.Errorf("Identify(%q) confidence of %v", tc.c.Banner, m.Confidence)
+		}
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	sigs, err := Parse([]byte(`
+[[signature]]
+product = "one"
+  [[signature.rule]]
+  field = "banner"
+  pattern = 'hello'
+  weight = 0.5
+  [[signature.rule]]
+  field = "errors"
+  pattern = '^530 '
+  weight = 0.5
+[[signature]]
+product = "two"
+  [[signature.rule]]
+  field = "banner"
+  pattern = 'hello'
+  weight = 0.6
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := Identify(sigs, Conversation{Banner: "220 hello"}); m.Product != "two" || m.Confidence != 0.6 {
+		t.Errorf("one rule: %+v", m)
+	}
+	// evidence adds up: 1 - 0.5 * 0.5
+	if m := Identify(sigs, Conversation{Banner: "220 hello", Errors: "331 ok\n530 no"}); m.Product != "one" || m.Confidence != 0.75 {
+		t.Errorf("two rules: %+v", m)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for content, want := range map[string]string{
+		"[[signature]]\nproduct = \"x\"\n[[signature.rule]]\nfield = \"motd\"\npattern = 'a'\nweight = 0.5":                "unknown field 'motd'",
+		"[[signature]]\nproduct = \"x\"\n[[signature.rule]]\nfield = \"banner\"\npattern = 'a'\nweight = 2":                "weight",
+		"[[signature]]\nproduct = \"x\"\n[[signature.rule]]\nfield = \"banner\"\npattern = '('\nweight = 0.5":              "missing closing )",
+		"[[signature]]\nproduct = \"x\"\n[[signature.rule]]\nfield = \"banner\"\npattern = 'a'\nweight = 0.5\nversion = 1": "no group 1",
+		"[[signature]]\nproduct = \"x\"\n[[signature.rule]]\nfield = \"banner\"\npatern = 'a'":                             "unknown setting",
+		"[[signature]]\n[[signature.rule]]\nfield = \"banner\"\npattern = 'a'\nweight = 0.5":                               "without a product",
+	} {
+		if _, err := Parse([]byte(content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", content, err, want)
+		}
+	}
+}
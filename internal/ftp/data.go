@@ -0,0 +1,176 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplyError is a command the server turned down, the code tells a command it doesn't
+// know (500, 502) from one it won't run for us (550)
+type ReplyError struct {
+	Reply
+}
+
+func (e *ReplyError) Error() string {
+	return e.Lines[0]
+}
+
+var PASV_ADDRESS = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// Protect gets the data connections in TLS as well (RFC 4217), for sessions whose control
+// connection already is
+func (s *Session) Protect(conf *tls.Config) error {
+	if _, err := s.Cmd("PBSZ 0"); err != nil {
+		return err
+	}
+	rep, err := s.Cmd("PROT P")
+	if err != nil {
+		return err
+	} else if rep.Code != 200 {
+		return &ReplyError{rep}
+	}
+	s.tls = conf
+	return nil
+}
+
+// Pwd gives the current directory, a quote in the name is doubled (RFC 959 appendix II)
+func (s *Session) Pwd() (string, error) {
+	rep, err := s.Cmd("PWD")
+	if err != nil {
+		return "", err
+	} else if rep.Code != 257 {
+		return "", &ReplyError{rep}
+	}
+	line := rep.Lines[0]
+	start := strings.Index(line, `"`)
+	if start < 0 {
+		return "", fmt.Errorf("no directory in '%s'", line)
+	}
+	dir := ""
+	for i := start + 1; i < len(line); i++ {
+		if line[i] != '"' {
+			dir += string(line[i])
+		} else if i+1 < len(line) && line[i+1] == '"' {
+			dir += `"`
+			i++
+		} else {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no directory in '%s'", line)
+}
+
+// List runs a command sending its result over a data connection, LIST, NLST or MLSD, and
+// gives the lines it got. Listings longer than max lines are cut short without error
+func (s *Session) List(command string, max int) ([]string, error) {
+	data, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	if err := s.send(command); err != nil {
+		return nil, err
+	}
+	rep, err := s.readOne()
+	if err != nil {
+		return nil, err
+	} else if rep.Code >= 400 {
+		return nil, &ReplyError{rep}
+	}
+	lines := []string{}
+	r := bufio.NewReader(data)
+	for len(lines) < max {
+		if s.Timeout > 0 {
+			data.SetReadDeadline(time.Now().Add(s.Timeout))
+		}
+		line, err := readLine(r)
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return lines, err
+		}
+	}
+	truncated := len(lines) >= max
+	data.Close()
+	if rep.Code < 200 {
+		if rep, err = s.Read(); err != nil {
+			return lines, err
+		}
+	}
+	// a server whose transfer we cut short says so with a 426
+	if rep.Code >= 400 && !truncated {
+		return lines, &ReplyError{rep}
+	}
+	return lines, nil
+}
+
+// dial opens a data connection in passive mode, EPSV first and PASV for the servers that
+// don't know about it. The address of a PASV reply is ignored for the one of the control
+// connection: servers behind NAT give their private address and we won't connect elsewhere
+func (s *Session) dial() (net.Conn, error) {
+	port := 0
+	if !s.pasv {
+		rep, err := s.Cmd("EPSV")
+		if err != nil {
+			return nil, err
+		} else if rep.Code == 229 {
+			port = epsvPort(rep.Lines[0])
+		} else {
+			s.pasv = true
+		}
+	}
+	if port == 0 {
+		rep, err := s.Cmd("PASV")
+		if err != nil {
+			return nil, err
+		} else if rep.Code != 227 {
+			return nil, &ReplyError{rep}
+		}
+		if m := PASV_ADDRESS.FindStringSubmatch(strings.Join(rep.Lines, " ")); m != nil {
+			p1, _ := strconv.Atoi(m[5])
+			p2, _ := strconv.Atoi(m[6])
+			port = p1<<8 | p2
+		}
+		if port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("no port in '%s'", rep.Lines[0])
+		}
+	}
+	host, _, _ := net.SplitHostPort(s.Conn.RemoteAddr().String())
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil || s.tls == nil {
+		return conn, err
+	}
+	return tls.Client(conn, s.tls), nil
+}
+
+// epsvPort reads the port of "229 Entering Extended Passive Mode (|||6446|)", the
+// delimiter being whatever character comes after the parenthesis (RFC 2428)
+func epsvPort(line string) int {
+	start, end := strings.Index(line, "("), strings.LastIndex(line, ")")
+	if start < 0 || end < start+2 {
+		return 0
+	}
+	fields := strings.Split(line[start+1:end], line[start+1:start+2])
+	if len(fields) != 5 {
+		return 0
+	}
+	port, err := strconv.Atoi(fields[3])
+	if err != nil || port <= 0 || port > 65535 {
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,151 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MAX_REPLY_LINES keeps a server from feeding us a never ending reply
+const MAX_REPLY_LINES = 1000
+
+// ErrClosing is a 421: the server is going away and closes the connection
+var ErrClosing = fmt.Errorf("service not available, closing control connection")
+
+// Reply is the answer of a server to a command, Lines has every line of a multi line reply
+type Reply struct {
+	Code  int
+	Lines []string
+}
+
+// ReadReply reads a reply as described in RFC 959: either a single "220 text" line or a
+// "220-" line followed by anything until a line starting with the same code and a space
+func ReadReply(r *bufio.Reader) (Reply, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return Reply{}, err
+	}
+	code := 0
+	if len(line) >= 3 {
+		code, _ = strconv.Atoi(line[:3])
+	}
+	if code < 100 || code > 599 || (len(line) > 3 && line[3] != ' ' && line[3] != '-') {
+		return Reply{0, []string{line}}, fmt.Errorf("malformed reply '%s'", line)
+	}
+	rep := Reply{code, []string{line}}
+	if len(line) == 3 || line[3] == ' ' {
+		return rep, nil
+	}
+	for len(rep.Lines) < MAX_REPLY_LINES {
+		if line, err = readLine(r); err != nil {
+			return rep, err
+		}
+		rep.Lines = append(rep.Lines, line)
+		if len(line) >= 4 && line[:3] == rep.Lines[0][:3] && line[3] == ' ' {
+			return rep, nil
+		}
+	}
+	return rep, fmt.Errorf("reply of more than %d lines", MAX_REPLY_LINES)
+}
+
+// readLine gives the next line without its end of line, what doesn't fit in the buffer
+// of the reader is dropped
+func readLine(r *bufio.Reader) (string, error) {
+	b, err := r.ReadSlice('\n')
+	line := strings.ToValidUTF8(strings.TrimRight(string(b), "\r\n"), "?")
+	for err == bufio.ErrBufferFull {
+		_, err = r.ReadSlice('\n')
+	}
+	return line, err
+}
+
+// Session is the control connection to a server, every command is sent once the reply of
+// the previous one is in as servers are free to drop what's been pipelined. With a Timeout
+// each command and reply gets that long, otherwise the deadline of Conn is left alone
+type Session struct {
+	Conn       net.Conn
+	Transcript []string
+	Timeout    time.Duration
+	r          *bufio.Reader
+	tls        *tls.Config
+	pasv       bool
+}
+
+func NewSession(conn net.Conn) *Session {
+	return &Session{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Read gets the next reply, preliminary 1xx replies are followed by the one we're after
+func (s *Session) Read() (Reply, error) {
+	for {
+		rep, err := s.readOne()
+		if err != nil || rep.Code >= 200 {
+			return rep, err
+		}
+	}
+}
+
+// readOne gets the next reply whatever it is, a transfer starts with a 1xx and we have to
+// read the data connection before the reply that ends it comes
+func (s *Session) readOne() (Reply, error) {
+	s.deadline()
+	rep, err := ReadReply(s.r)
+	s.Transcript = append(s.Transcript, rep.Lines...)
+	if err == nil && rep.Code == 421 {
+		err = ErrClosing
+	}
+	return rep, err
+}
+
+func (s *Session) Cmd(command string) (Reply, error) {
+	if err := s.send(command); err != nil {
+		return Reply{}, err
+	}
+	return s.Read()
+}
+
+func (s *Session) send(command string) error {
+	s.deadline()
+	_, err := fmt.Fprintf(s.Conn, "%s\r\n", command)
+	return err
+}
+
+func (s *Session) deadline() {
+	if s.Timeout > 0 {
+		s.Conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+}
+
+// Login tries the anonymous account: USER can be enough with a 230, a 331 asks for
+// the password and anything else, 530 included, means anonymous isn't welcome. A 421
+// comes back as ErrClosing
+func (s *Session) Login() (bool, error) {
+	rep, err := s.Cmd("USER anonymous")
+	if err != nil {
+		return false, err
+	} else if rep.Code == 230 {
+		return true, nil
+	} else if rep.Code != 331 {
+		return false, nil
+	}
+	if rep, err = s.Cmd("PASS anonymous"); err != nil {
+		return false, err
+	}
+	return rep.Code == 230 || rep.Code == 202, nil
+}
+
+// TLSConfig is what we use to talk TLS with a server. We're after what servers present,
+// not whether we'd trust them, so nothing gets verified. The session cache is there for
+// the servers that want the data connections to resume the session of the control one
+func TLSConfig(host string) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+		ServerName:         host,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+}
@@ -0,0 +1,57 @@
+package ftp
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadReply(t *testing.T) {
+	for _, tc := range []struct {
+		sent  string
+		code  int
+		lines []string
+		err   bool
+	}{
+		{"220 ready\r\n", 220, []string{"220 ready"}, false},
+		{"220\r\n", 220, []string{"220"}, false},
+		{"230-Welcome\r\n230-to our server\r\n230 logged in\r\n", 230, []string{"230-Welcome", "230-to our server", "230 logged in"}, false},
+		// lines in the middle of a reply can look like anything, even another code
+		{"211-Features:\r\n AUTH TLS\r\n211-no\r\n200 nope\r\n211 End\r\n", 211, []string{"211-Features:", " AUTH TLS", "211-no", "200 nope", "211 End"}, false},
+		{"220 unix\n", 220, []string{"220 unix"}, false},
+		{"SSH-2.0-OpenSSH_8.9\r\n", 0, []string{"SSH-2.0-OpenSSH_8.9"}, true},
+		{"2200 nope\r\n", 0, []string{"2200 nope"}, true},
+		{"230-never ends\r\n", 230, []string{"230-never ends"}, true},
+		{"", 0, nil, true},
+	} {
+		rep, err := ReadReply(bufio.NewReader(strings.NewReader(tc.sent)))
+		if rep.Code != tc.code || !reflect.DeepEqual(rep.Lines, tc.lines) || (err != nil) != tc.err {
+			t.Errorf("ReadReply(%q) = %d %q %v, want %d %q", tc.sent, rep.Code, rep.Lines, err, tc.code, tc.lines)
+		}
+	}
+}
+
+func TestReadReplyLongLine(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader("220 "+strings.Repeat("a", 100)+"\r\n331 next\r\n"), 16)
+	if rep, err := ReadReply(r); err != nil || rep.Lines[0] != "220 aaaaaaaaaaaa" {
+		t.Errorf("long line: %q %v", rep.Lines, err)
+	}
+	if rep, err := ReadReply(r); err != nil || rep.Code != 331 {
+		t.Errorf("reply after a long line: %q %v", rep.Lines, err)
+	}
+}
+
+func TestEpsvPort(t *testing.T) {
+	for line, want := range map[string]int{
+		"229 Entering Extended Passive Mode (|||6446|)": 6446,
+		"229 ok (!!!21!)": 21,
+		"229 ok (|||0|)":  0,
+		"229 ok (|||x|)":  0,
+		"229 ok":          0,
+	} {
+		if got := epsvPort(line); got != want {
+			t.Errorf("epsvPort(%q) = %d, want %d", line, got, want)
+		}
+	}
+}
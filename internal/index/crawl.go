@@ -0,0 +1,170 @@
+package index
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/ftp"
+	"github.com/mickael-kerjean/ftpscan/internal/listing"
+	"github.com/mickael-kerjean/ftpscan/internal/shutdown"
+	"net"
+	"path"
+	"time"
+)
+
+type crawlResult struct {
+	connected   bool
+	available   bool
+	anonymous   bool
+	entries     int
+	directories int
+	// budget is the one that stopped the crawl: entries, time or shutdown, or depth when
+	// directories were left out for being too deep
+	budget string
+}
+
+type directory struct {
+	path  string
+	depth int
+}
+
+// crawl logs in anonymously and lists the tree of the server breadth first, the
+// directories we can't get into are skipped. in is called once we're logged in, before
+// the first entry goes to found
+func crawl(addr string, implicit bool, in func(), found func(entry)) (res crawlResult, err error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, TIMEOUT)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close()
+	res.connected = true
+	var conf *tls.Config
+	if implicit {
+		host, _, _ := net.SplitHostPort(addr)
+		conf = ftp.TLSConfig(host)
+		conn = tls.Client(conn, conf)
+	}
+	s := ftp.NewSession(conn)
+	s.Timeout = TIMEOUT
+
+	if rep, err := s.Read(); err != nil {
+		return res, err
+	} else if rep.Code != 220 {
+		return res, fmt.Errorf("unexpected greeting '%s'", rep.Lines[0])
+	}
+	res.available = true
+	if res.anonymous, err = s.Login(); err != nil || !res.anonymous {
+		return res, err
+	}
+	if conf != nil {
+		if err = s.Protect(conf); err != nil {
+			return res, err
+		}
+	}
+	root, err := s.Pwd()
+	if err != nil {
+		root = "/"
+	}
+	in()
+
+	l := &lister{session: s, method: "MLSD"}
+	// directories too deep are skipped, the others still get listed
+	deep := false
+	queue := []directory{{root, 0}}
+	seen := map[string]bool{root: true}
+	for len(queue) > 0 {
+		switch {
+		case shutdown.Stopped():
+			res.budget = "shutdown"
+		case time.Since(start) > MAX_TIME:
+			res.budget = "time"
+		case res.entries >= MAX_ENTRIES:
+			res.budget = "entries"
+		}
+		if res.budget != "" {
+			break
+		}
+		dir := queue[0]
+		queue = queue[1:]
+		entries, err := l.list(dir.path, MAX_ENTRIES-res.entries)
+		if _, ok := err.(*ftp.ReplyError); ok {
+			continue
+		} else if err != nil {
+			return res, err
+		}
+		res.directories++
+		for _, e := range entries {
+			e.path = dir.path
+			found(e)
+			res.entries++
+			child := path.Join(dir.path, e.name)
+			if e.kind != "dir" || seen[child] {
+				continue
+			} else if dir.depth >= MAX_DEPTH {
+				deep = true
+				continue
+			}
+			seen[child] = true
+			queue = append(queue, directory{child, dir.depth + 1})
+		}
+	}
+	if res.budget == "" && deep {
+		res.budget = "depth"
+	}
+	s.Cmd("QUIT")
+	return res, nil
+}
+
+// lister lists directories with the best command the server has: MLSD until it says it
+// doesn't know about it, then LIST until we can't make sense of what it sends and NLST
+type lister struct {
+	session *ftp.Session
+	method  string
+}
+
+func (l *lister) list(dir string, max int) ([]entry, error) {
+	if rep, err := l.session.Cmd("CWD " + dir); err != nil {
+		return nil, err
+	} else if rep.Code != 250 {
+		return nil, &ftp.ReplyError{Reply: rep}
+	}
+	if l.method == "MLSD" {
+		lines, err := l.session.List("MLSD", max)
+		if !unknownCommand(err) {
+			return parse(lines, parseMLSD), err
+		}
+		l.method = "LIST"
+	}
+	if l.method == "LIST" {
+		lines, err := l.session.List("LIST", max)
+		if err != nil {
+			return nil, err
+		}
+		entries := []entry{}
+		for _, e := range listing.ParseLines(lines, time.Now().UTC()) {
+			entries = append(entries, fromListing(e))
+		}
+		if len(entries) > 0 || len(lines) <= 1 {
+			// an empty directory is a "total 0" or nothing at all
+			return entries, nil
+		}
+		l.method = "NLST"
+	}
+	lines, err := l.session.List("NLST", max)
+	return parse(lines, parseNLST), err
+}
+
+func parse(lines []string, parser func(string) (entry, bool)) []entry {
+	entries := []entry{}
+	for _, line := range lines {
+		if e, ok := parser(line); ok && e.name != "." && e.name != ".." {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func unknownCommand(err error) bool {
+	e, ok := err.(*ftp.ReplyError)
+	return ok && (e.Code == 500 || e.Code == 502 || e.Code == 504)
+}
@@ -0,0 +1,189 @@
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// serve is an anonymous server whose listings are given by command then by directory, the
+// commands missing from listings are unknown to it. Without epsv it only knows PASV
+func serve(t *testing.T, epsv bool, listings map[string]map[string][]string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		fmt.Fprintf(c, "220 ready\r\n")
+		r := bufio.NewReader(c)
+		cwd, data := "/", net.Listener(nil)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+			switch fields[0] {
+			case "USER":
+				fmt.Fprintf(c, "331 password please\r\n")
+			case "PASS":
+				fmt.Fprintf(c, "230 logged in\r\n")
+			case "PWD":
+				fmt.Fprintf(c, "257 \"%s\" is the current directory\r\n", cwd)
+			case "CWD":
+				if _, ok := listings["NLST"][fields[1]]; ok {
+					cwd = fields[1]
+					fmt.Fprintf(c, "250 ok\r\n")
+				} else {
+					fmt.Fprintf(c, "550 no such directory\r\n")
+				}
+			case "EPSV", "PASV":
+				if fields[0] == "EPSV" && !epsv {
+					fmt.Fprintf(c, "500 unknown command\r\n")
+					continue
+				}
+				data, _ = net.Listen("tcp", "127.0.0.1:0")
+				port := data.Addr().(*net.TCPAddr).Port
+				if fields[0] == "EPSV" {
+					fmt.Fprintf(c, "229 Entering Extended Passive Mode (|||%d|)\r\n", port)
+				} else {
+					// the address is ignored for the one of the control connection
+					fmt.Fprintf(c, "227 Entering Passive Mode (10,0,0,1,%d,%d)\r\n", port>>8, port&0xff)
+				}
+			case "MLSD", "LIST", "NLST":
+				lines, ok := listings[fields[0]][cwd]
+				if _, known := listings[fields[0]]; !known {
+					fmt.Fprintf(c, "500 unknown command\r\n")
+					data.Close()
+					continue
+				} else if !ok {
+					fmt.Fprintf(c, "550 can't list\r\n")
+					data.Close()
+					continue
+				}
+				fmt.Fprintf(c, "150 here it comes\r\n")
+				d, err := data.Accept()
+				data.Close()
+				if err != nil {
+					return
+				}
+				for _, line := range lines {
+					fmt.Fprintf(d, "%s\r\n", line)
+				}
+				d.Close()
+				fmt.Fprintf(c, "226 done\r\n")
+			case "QUIT":
+				fmt.Fprintf(c, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprintf(c, "502 not implemented\r\n")
+			}
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func crawlAll(t *testing.T, addr string) (crawlResult, []string) {
+	found := []string{}
+	res, err := crawl(addr, false, func() {}, func(e entry) {
+		found = append(found, fmt.Sprintf("%s %s %s %d", e.path, e.name, e.kind, e.size.Int64))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(found)
+	return res, found
+}
+
+func TestCrawl(t *testing.T) {
+	tree := map[string]map[string][]string{
+		"MLSD": {
+			"/": {
+				"type=cdir;modify=20200102030405; .",
+				"type=dir;modify=20200102030405;UNIX.mode=0755; pub",
+				"type=file;size=10;modify=20200102030405;perm=r; readme.txt",
+				"type=OS.unix=slink:/pub;modify=20200102030405; link",
+			},
+			"/pub": {
+				"type=pdir; ..",
+				"type=dir; private",
+				"type=file;size=2048; my file.iso",
+			},
+		},
+		"LIST": {
+			"/": {
+				"total 3",
+				"drwxr-xr-x    2 ftp      ftp          4096 Jan 02  2020 pub",
+				"-rw-r--r--    1 ftp      ftp            10 Jan 02  2020 readme.txt",
+				"lrwxrwxrwx    1 ftp      ftp             4 Jan 02  2020 link -> /pub",
+			},
+			// the format of the listing is told line by line
+			"/pub": {
+				"01-02-20  03:04PM       <DIR>          private",
+				"01-02-20  03:04PM                 2048 my file.iso",
+			},
+		},
+		"NLST": {"/": {"pub", "readme.txt", "link"}, "/pub": {"private", "my file.iso"}, "/pub/private": {}},
+	}
+	want := []string{"/ link link 0", "/ pub dir 0", "/ readme.txt file 10", "/pub my file.iso file 2048", "/pub private dir 0"}
+
+	res, found := crawlAll(t, serve(t, true, tree))
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("MLSD: %q, want %q", found, want)
+	}
+	if !res.anonymous || res.entries != 5 || res.directories != 2 || res.budget != "" {
+		t.Errorf("MLSD: %+v", res)
+	}
+
+	// without MLSD nor EPSV, ls gives the size of directories and links as well
+	delete(tree, "MLSD")
+	want = []string{"/ link link 4", "/ pub dir 4096", "/ readme.txt file 10", "/pub my file.iso file 2048", "/pub private dir 0"}
+	if _, found = crawlAll(t, serve(t, false, tree)); !reflect.DeepEqual(found, want) {
+		t.Errorf("LIST: %q, want %q", found, want)
+	}
+
+	// a listing we can't read leaves us with names only
+	tree["LIST"]["/"] = []string{"pub   <DIR>", "readme.txt   10"}
+	want = []string{"/ link unknown 0", "/ pub unknown 0", "/ readme.txt unknown 0"}
+	if _, found = crawlAll(t, serve(t, true, tree)); !reflect.DeepEqual(found, want) {
+		t.Errorf("NLST: %q, want %q", found, want)
+	}
+}
+
+func TestCrawlBudgets(t *testing.T) {
+	tree := map[string]map[string][]string{
+		"MLSD": {
+			"/":    {"type=dir; a", "type=dir; c", "type=file; 1"},
+			"/a":   {"type=dir; b", "type=file; 2"},
+			"/a/b": {"type=file; 3"},
+			"/c":   {"type=dir; d", "type=file; 4"},
+			"/c/d": {"type=file; 5"},
+		},
+		"NLST": {"/": {}, "/a": {}, "/a/b": {}, "/c": {}, "/c/d": {}},
+	}
+	defer func(depth, entries int) { MAX_DEPTH, MAX_ENTRIES = depth, entries }(MAX_DEPTH, MAX_ENTRIES)
+
+	// a directory too deep doesn't keep its siblings from being listed
+	MAX_DEPTH = 1
+	if res, found := crawlAll(t, serve(t, true, tree)); res.budget != "depth" || res.directories != 3 || len(found) != 7 {
+		t.Errorf("depth: %+v %q", res, found)
+	}
+	MAX_DEPTH = 2
+	if res, found := crawlAll(t, serve(t, true, tree)); res.budget != "" || res.directories != 5 || len(found) != 9 {
+		t.Errorf("deep enough: %+v %q", res, found)
+	}
+	MAX_DEPTH, MAX_ENTRIES = 10, 4
+	if res, found := crawlAll(t, serve(t, true, tree)); res.budget != "entries" || len(found) != 4 {
+		t.Errorf("entries: %+v %q", res, found)
+	}
+}
@@ -0,0 +1,175 @@
+package index
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+	"github.com/mickael-kerjean/ftpscan/internal/shutdown"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the budgets keep a single server from holding a worker forever: MAX_DEPTH directories
+// deep, MAX_ENTRIES entries and MAX_TIME, whichever comes first
+var (
+	CONCURRENCY      int           = 50
+	TIMEOUT          time.Duration = 30 * time.Second
+	SHUTDOWN_TIMEOUT time.Duration = 30 * time.Second
+	MAX_DEPTH        int           = 20
+	MAX_ENTRIES      int           = 100000
+	MAX_TIME         time.Duration = 30 * time.Minute
+	REVISIT          time.Duration = 0
+	WRITER           *storage.Writer
+)
+
+// Cmd is the index phase: crawl the publicly available ftp servers
+func Cmd(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	fs.IntVar(&CONCURRENCY, "concurrency", CONCURRENCY, "number of servers crawled at the same time")
+	fs.DurationVar(&TIMEOUT, "timeout", TIMEOUT, "time given to connect and to each reply or read of a listing")
+	fs.DurationVar(&SHUTDOWN_TIMEOUT, "shutdown-timeout", SHUTDOWN_TIMEOUT, "time given to the crawls in flight when stopping")
+	fs.IntVar(&MAX_DEPTH, "max-depth", MAX_DEPTH, "how deep we go down the tree of a server, 0 for its top directory only")
+	fs.IntVar(&MAX_ENTRIES, "max-entries", MAX_ENTRIES, "maximum number of entries kept for a server")
+	fs.DurationVar(&MAX_TIME, "max-time", MAX_TIME, "time given to the crawl of a server")
+	fs.DurationVar(&REVISIT, "revisit", REVISIT, "crawl again the servers indexed longer ago than that, 0 for never")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan index [-concurrency n] [-timeout d] [-max-depth n] [-max-entries n] [-max-time d] [-revisit d]
+
+Every server the explore phase found open to anonymous users is crawled from the directory
+it puts us in, every entry landing in the file table with its path, name, type, size,
+mtime and permissions. Directories are listed with MLSD and with LIST on the servers that
+don't support it, the listings of unix, windows, EPLF and VMS servers are understood. NLST
+is the last resort: it only gives names so we can't go deeper. Symbolic links aren't
+followed.
+
+A crawl stops after -max-depth directories deep, -max-entries entries or -max-time,
+what was listed by then is kept. The entries of a server are replaced each time it's
+crawled, with -revisit the servers indexed longer ago than that are crawled again.
+`)
+	}
+	fs.Parse(args)
+	if err := Settings().Validate(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	} else if err := storage.Open(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	config.Print("index", Settings())
+	shutdown.Handle()
+	WRITER = storage.NewWriter()
+
+	// the hosts of the optout registry were purged along with their details, they can't
+	// come up here
+	index := "details.indexed_at IS NULL"
+	if REVISIT > 0 {
+		index += fmt.Sprintf(" OR details.indexed_at < datetime('now', '-%d seconds')", int64(REVISIT.Seconds()))
+	}
+	rows, err := storage.DB.Query(`SELECT related_ip, related_port, COALESCE(tls_mode, '') FROM details
+  WHERE anonymous = 1 AND (` + index + `) ORDER BY COALESCE(indexed_at, '')`)
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	queue := make(chan host)
+	var wg sync.WaitGroup
+	for i := 0; i < CONCURRENCY; i++ {
+		wg.Add(1)
+		go func() {
+			for h := range queue {
+				runner(h)
+			}
+			wg.Done()
+		}()
+	}
+	crawled := 0
+	for rows.Next() && !shutdown.Stopped() {
+		var h host
+		var ip string
+		rows.Scan(&ip, &h.port, &h.tlsMode)
+		h.ip = net.ParseIP(ip)
+		select {
+		case queue <- h:
+			crawled++
+		case <-shutdown.STOP:
+		}
+	}
+	rows.Close()
+	close(queue)
+	if !shutdown.Wait(&wg, SHUTDOWN_TIMEOUT) {
+		fmt.Printf("> gave up on the servers still being crawled after %s\n", SHUTDOWN_TIMEOUT)
+	}
+	if err := WRITER.Close(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+	}
+	fmt.Printf("> %d servers crawled\n", crawled)
+	fmt.Printf("> writes: %s\n", WRITER.String())
+	storage.DB.Close()
+	if shutdown.Stopped() {
+		os.Exit(1)
+	}
+}
+
+type host struct {
+	ip      net.IP
+	port    int
+	tlsMode string
+}
+
+func runner(h host) {
+	addr := net.JoinHostPort(h.ip.String(), strconv.Itoa(h.port))
+	start := time.Now()
+	// the entries of the previous crawl go away once we're in, not before: a server
+	// that's gone keeps what we knew of it
+	res, err := crawl(addr, h.tlsMode == "implicit", func() {
+		WRITER.Write(FILE_DELETE, h.ip.String(), h.port)
+	}, func(e entry) {
+		WRITER.Write(FILE_INSERT, h.ip.String(), h.port, e.path, e.name, e.kind, e.size, e.mtime, nullString(e.permissions))
+	})
+	summary := fmt.Sprintf("%d entries in %d directories", res.entries, res.directories)
+	if err != nil {
+		fmt.Printf("%v => %+v\n", addr, err)
+		summary += ", " + err.Error()
+	} else if res.budget != "" {
+		summary += ", stopped by the " + res.budget + " budget"
+	}
+	if res.anonymous {
+		WRITER.Write(INDEXED_UPDATE, h.ip.String(), h.port)
+	}
+	WRITER.Observe(h.ip.String(), h.port, "index", res.outcome(), start, summary)
+	storage.Emit("index", map[string]interface{}{
+		"ip": h.ip.String(), "port": h.port, "anonymous": res.anonymous,
+		"entries": res.entries, "directories": res.directories, "budget": res.budget,
+	})
+}
+
+func (res crawlResult) outcome() string {
+	switch {
+	case !res.connected:
+		return storage.OUTCOME_UNREACHABLE
+	case !res.available:
+		return storage.OUTCOME_UNAVAILABLE
+	case res.anonymous:
+		return storage.OUTCOME_ANONYMOUS
+	}
+	return storage.OUTCOME_AVAILABLE
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+const FILE_DELETE = `DELETE FROM file WHERE related_ip = $1 AND related_port = $2`
+
+const FILE_INSERT = `INSERT INTO file(related_ip, related_port, path, name, type, size, mtime, permissions)
+  VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+  ON CONFLICT(related_ip, related_port, path, name) DO UPDATE SET
+    type = excluded.type, size = excluded.size, mtime = excluded.mtime, permissions = excluded.permissions`
+
+const INDEXED_UPDATE = `UPDATE details SET indexed_at = CURRENT_TIMESTAMP WHERE related_ip = $1 AND related_port = $2`
@@ -0,0 +1,86 @@
+package index
+
+import (
+	"database/sql"
+	"github.com/mickael-kerjean/ftpscan/internal/listing"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entry is a line of a listing, path is the directory it was found in
+type entry struct {
+	path        string
+	name        string
+	kind        string
+	size        sql.NullInt64
+	mtime       sql.NullString
+	permissions string
+}
+
+// parseMLSD reads a line of MLSD (RFC 3659): facts separated by ';', a space and the name,
+// eg: "type=file;size=1024;modify=20200102030405;UNIX.mode=0644; notes.txt"
+func parseMLSD(line string) (entry, bool) {
+	i := strings.Index(line, " ")
+	if i < 0 {
+		return entry{}, false
+	}
+	e := entry{name: line[i+1:], kind: "other"}
+	perm, mode := "", ""
+	for _, fact := range strings.Split(line[:i], ";") {
+		kv := strings.SplitN(fact, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := kv[1]
+		switch strings.ToLower(kv[0]) {
+		case "type":
+			switch value = strings.ToLower(value); {
+			case value == "file" || value == "dir":
+				e.kind = value
+			case value == "cdir" || value == "pdir":
+				return entry{}, false
+			case strings.HasPrefix(value, "os.unix=slink") || strings.HasPrefix(value, "os.unix=symlink"):
+				e.kind = "link"
+			}
+		case "size", "sizd":
+			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+				e.size = sql.NullInt64{Int64: size, Valid: true}
+			}
+		case "modify":
+			// fractions of a second are optional
+			if t, err := time.Parse("20060102150405", strings.SplitN(value, ".", 2)[0]); err == nil {
+				e.mtime = sql.NullString{String: t.Format(storage.TIMESTAMP), Valid: true}
+			}
+		case "perm":
+			perm = value
+		case "unix.mode":
+			mode = value
+		}
+	}
+	if e.permissions = mode; mode == "" {
+		e.permissions = perm
+	}
+	return e, e.name != ""
+}
+
+// fromListing is an entry of LIST, whatever the format of the server
+func fromListing(l listing.Entry) entry {
+	e := entry{name: l.Name, kind: l.Type, permissions: l.Permissions}
+	if l.Size >= 0 {
+		e.size = sql.NullInt64{Int64: l.Size, Valid: true}
+	}
+	if !l.Time.IsZero() {
+		e.mtime = sql.NullString{String: l.Time.Format(storage.TIMESTAMP), Valid: true}
+	}
+	return e
+}
+
+// parseNLST reads a line of NLST, a name and nothing else. Some servers give the path
+// of the entry rather than its name
+func parseNLST(line string) (entry, bool) {
+	name := path.Base(strings.TrimRight(line, "/"))
+	return entry{name: name, kind: "unknown"}, name != "" && name != "/"
+}
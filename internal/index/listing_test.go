@@ -0,0 +1,21 @@
+package index
+
+import (
+	"testing"
+)
+
+func TestParseMLSD(t *testing.T) {
+	e, ok := parseMLSD("Type=file;Size=1024;Modify=20200102030405.123;perm=adfrw;UNIX.mode=0644; notes 2020.txt")
+	if !ok || e.name != "notes 2020.txt" || e.kind != "file" || e.size.Int64 != 1024 ||
+		e.mtime.String != "2020-01-02 03:04:05" || e.permissions != "0644" {
+		t.Errorf("parseMLSD = %+v", e)
+	}
+	if e, ok = parseMLSD("type=dir;perm=el; pub"); !ok || e.kind != "dir" || e.size.Valid || e.mtime.Valid || e.permissions != "el" {
+		t.Errorf("parseMLSD of a directory = %+v", e)
+	}
+	for _, line := range []string{"type=cdir; /pub", "type=pdir; ..", "garbage", "type=file; "} {
+		if e, ok = parseMLSD(line); ok {
+			t.Errorf("parseMLSD(%q) = %+v", line, e)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package index
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+)
+
+// Settings gives the current settings of the index phase
+func Settings() config.Index {
+	return config.Index{
+		Concurrency:     CONCURRENCY,
+		Timeout:         config.Duration{Duration: TIMEOUT},
+		ShutdownTimeout: config.Duration{Duration: SHUTDOWN_TIMEOUT},
+		MaxDepth:        MAX_DEPTH,
+		MaxEntries:      MAX_ENTRIES,
+		MaxTime:         config.Duration{Duration: MAX_TIME},
+		Revisit:         config.Duration{Duration: REVISIT},
+	}
+}
+
+// Configure applies the settings of the config file, the flags have the last word
+func Configure(c config.Index) {
+	CONCURRENCY, TIMEOUT, SHUTDOWN_TIMEOUT = c.Concurrency, c.Timeout.Duration, c.ShutdownTimeout.Duration
+	MAX_DEPTH, MAX_ENTRIES, MAX_TIME, REVISIT = c.MaxDepth, c.MaxEntries, c.MaxTime.Duration, c.Revisit.Duration
+}
@@ -0,0 +1,320 @@
+package listing
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// types of an entry, OTHER being devices, sockets, pipes and whatever else there is
+const (
+	FILE  = "file"
+	DIR   = "dir"
+	LINK  = "link"
+	OTHER = "other"
+)
+
+// Entry is a line of a LIST reply whatever its format. Size is -1 and Time zero when the
+// listing doesn't tell, times have no zone and are taken as UTC
+type Entry struct {
+	Format      string
+	Name        string
+	Type        string
+	Size        int64
+	Time        time.Time
+	Permissions string
+	Owner       string
+	Group       string
+	Target      string
+}
+
+// Parse reads a line of LIST in any of the formats we know about: unix ls -l, the one of
+// windows and IIS, EPLF and VMS. now is when the listing was made, it gives the year of
+// unix dates that come without one. Lines that aren't entries (totals, headers, blank
+// lines) aren't ok
+func Parse(line string, now time.Time) (Entry, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "+"):
+		return parseEPLF(line)
+	case len(line) > 0 && line[0] >= '0' && line[0] <= '9':
+		return parseDOS(line)
+	case VMS_NAME.MatchString(line):
+		return parseVMS(line)
+	}
+	return parseUnix(line, now)
+}
+
+// ParseLines reads a whole listing, skipping what isn't an entry along with the "." and
+// ".." of the servers that list them. VMS puts the details of entries with a long name on
+// a line of their own, those lines are put back together
+func ParseLines(lines []string, now time.Time) []Entry {
+	entries := []Entry{}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if VMS_NAME_ONLY.MatchString(line) && i+1 < len(lines) && strings.HasPrefix(lines[i+1], " ") {
+			line, i = strings.TrimSpace(line)+" "+strings.TrimSpace(lines[i+1]), i+1
+		}
+		if e, ok := Parse(line, now); ok && e.Name != "." && e.Name != ".." {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// UNIX_MODE is the first column of ls -l: the type, the permissions and a mark for ACLs
+// or extended attributes on some systems
+var UNIX_MODE = regexp.MustCompile(`^[-bcdlpsDn?][-rwxsStTlL]{9}[.+@]?$`)
+
+var MONTHS = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+type field struct {
+	text string
+	end  int
+}
+
+// parseUnix reads a line of ls -l: "-rw-r--r-- 1 owner group 1024 Jan  2 03:04 name".
+// Servers differ in the columns between the mode and the date, the date is what anchors
+// the line: the size comes right before it (major, minor for devices) and the name after
+func parseUnix(line string, now time.Time) (Entry, bool) {
+	fields := splitFields(line)
+	if len(fields) < 5 || !UNIX_MODE.MatchString(fields[0].text) {
+		return Entry{}, false
+	}
+	e := Entry{Format: "unix", Type: OTHER, Size: -1, Permissions: fields[0].text[1:10]}
+	switch fields[0].text[0] {
+	case '-':
+		e.Type = FILE
+	case 'd':
+		e.Type = DIR
+	case 'l':
+		e.Type = LINK
+	}
+	// servers putting the day first are few, a month first anywhere on the line wins
+	for _, dayFirst := range []bool{false, true} {
+		for i := 2; i < len(fields)-1; i++ {
+			t, n, ok := unixDate(fields[i:], now, dayFirst)
+			if !ok || i+n >= len(fields) {
+				continue
+			}
+			meta, size := fields[1:i-1], fields[i-1].text
+			switch {
+			case i >= 3 && strings.HasSuffix(fields[i-2].text, ","):
+				// major and minor of a device: "1, 3"
+				meta = fields[1 : i-2]
+			case strings.Contains(size, ","):
+				// or "1,3"
+			default:
+				bytes, err := strconv.ParseInt(size, 10, 64)
+				if err != nil {
+					continue
+				}
+				e.Size = bytes
+			}
+			// the number of links is there on most servers, the group on some
+			if len(meta) > 0 && isNumber(meta[0].text) {
+				meta = meta[1:]
+			}
+			if len(meta) > 0 {
+				e.Owner = meta[0].text
+			}
+			if len(meta) > 1 {
+				e.Group = meta[1].text
+			}
+			e.Time = t
+			e.Name = strings.TrimLeft(line[fields[i+n-1].end:], " \t")
+			if e.Type == LINK {
+				if j := strings.Index(e.Name, " -> "); j >= 0 {
+					e.Name, e.Target = e.Name[:j], e.Name[j+4:]
+				}
+			}
+			return e, e.Name != ""
+		}
+	}
+	return Entry{}, false
+}
+
+// unixDate reads the date starting at the first field and tells how many fields it took:
+// "Jan 2 03:04" and "Jan 2 2020", "2 Jan 2020" with dayFirst, or "2020-01-02 03:04" with
+// ls --time-style=long-iso
+func unixDate(fields []field, now time.Time, dayFirst bool) (time.Time, int, bool) {
+	if len(fields) >= 2 && len(fields[0].text) == 10 && !dayFirst {
+		if t, err := time.Parse("2006-01-02", fields[0].text); err == nil {
+			clock := strings.SplitN(fields[1].text, ".", 2)[0]
+			for _, layout := range []string{"15:04:05", "15:04"} {
+				if c, err := time.Parse(layout, clock); err == nil {
+					t = t.Add(time.Duration(c.Hour())*time.Hour + time.Duration(c.Minute())*time.Minute + time.Duration(c.Second())*time.Second)
+					// full-iso comes with the zone
+					if len(fields) >= 3 && len(fields[2].text) == 5 && (fields[2].text[0] == '+' || fields[2].text[0] == '-') && isNumber(fields[2].text[1:]) {
+						return t, 3, true
+					}
+					return t, 2, true
+				}
+			}
+		}
+		return time.Time{}, 0, false
+	}
+	if len(fields) < 3 {
+		return time.Time{}, 0, false
+	}
+	month, day := monthOf(fields[0].text), fields[1].text
+	if dayFirst {
+		month, day = monthOf(fields[1].text), fields[0].text
+	}
+	d, err := strconv.Atoi(day)
+	if month == 0 || err != nil || d < 1 || d > 31 {
+		return time.Time{}, 0, false
+	}
+	last := fields[2].text
+	if len(last) == 4 && isNumber(last) {
+		year, _ := strconv.Atoi(last)
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC), 3, true
+	}
+	c, err := time.Parse("15:04", last)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	// dates of the last six months come without a year, it's the one that puts them in
+	// the past. A day of margin is there for clocks and time zones that don't agree
+	for year := now.Year(); year >= now.Year()-4; year-- {
+		t := time.Date(year, month, d, c.Hour(), c.Minute(), 0, 0, time.UTC)
+		if t.Day() == d && !t.After(now.Add(24*time.Hour)) {
+			return t, 3, true
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// DOS_LINE is a line of windows and IIS: "01-02-20  03:04PM  <DIR>  name", some servers
+// write the year in full, use slashes or a 24 hour clock
+var DOS_LINE = regexp.MustCompile(`^(\d{1,2})[-/](\d{1,2})[-/](\d{4}|\d{2})\s+(\d{1,2}):(\d{2})(?::\d{2})?\s*([AaPp][Mm])?\s+(<DIR>|<JUNCTION>|[\d,]+)\s+(.+)$`)
+
+func parseDOS(line string) (Entry, bool) {
+	m := DOS_LINE.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false
+	}
+	e := Entry{Format: "dos", Name: m[8], Type: FILE, Size: -1}
+	if m[7] == "<DIR>" || m[7] == "<JUNCTION>" {
+		e.Type = DIR
+	} else if size, err := strconv.ParseInt(strings.Replace(m[7], ",", "", -1), 10, 64); err == nil {
+		e.Size = size
+	}
+	month, _ := strconv.Atoi(m[1])
+	day, _ := strconv.Atoi(m[2])
+	year, _ := strconv.Atoi(m[3])
+	hour, _ := strconv.Atoi(m[4])
+	minute, _ := strconv.Atoi(m[5])
+	if len(m[3]) == 2 {
+		year += 1900
+		if year < 1970 {
+			year += 100
+		}
+	}
+	switch strings.ToUpper(m[6]) {
+	case "AM":
+		hour = hour % 12
+	case "PM":
+		hour = hour%12 + 12
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 {
+		return Entry{}, false
+	}
+	e.Time = time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.UTC)
+	return e, true
+}
+
+// parseEPLF reads the Easily Parsed LIST Format of D. J. Bernstein: facts separated by
+// commas then a tab and the name, eg: "+i8388621.48594,m825718503,r,s280,up644,\tdjb.html".
+// "/" is a directory we can CWD into, "r" a file we can RETR
+func parseEPLF(line string) (Entry, bool) {
+	tab := strings.Index(line, "\t")
+	if tab < 0 || tab == len(line)-1 {
+		return Entry{}, false
+	}
+	e := Entry{Format: "eplf", Name: line[tab+1:], Type: OTHER, Size: -1}
+	for _, fact := range strings.Split(line[1:tab], ",") {
+		switch {
+		case fact == "/":
+			e.Type = DIR
+		case fact == "r" && e.Type != DIR:
+			e.Type = FILE
+		case strings.HasPrefix(fact, "s"):
+			if size, err := strconv.ParseInt(fact[1:], 10, 64); err == nil {
+				e.Size = size
+			}
+		case strings.HasPrefix(fact, "m"):
+			if sec, err := strconv.ParseInt(fact[1:], 10, 64); err == nil {
+				e.Time = time.Unix(sec, 0).UTC()
+			}
+		case strings.HasPrefix(fact, "up"):
+			e.Permissions = fact[2:]
+		}
+	}
+	return e, true
+}
+
+// VMS_NAME is the start of a VMS line, a name and its version: "README.TXT;1"
+var VMS_NAME = regexp.MustCompile(`^[^\s;]+;\d+(\s|$)`)
+
+var VMS_NAME_ONLY = regexp.MustCompile(`^[^\s;]+;\d+\s*$`)
+
+// VMS_LINE is a line of VMS: the name, the size in blocks of 512 bytes used and allocated,
+// the date, the owner and the protection of system, owner, group and world
+// "README.TXT;1   2/4   2-JAN-2020 03:04:05  [GROUP,OWNER]  (RWED,RWED,RE,)"
+var VMS_LINE = regexp.MustCompile(`^([^\s;]+);(\d+)\s+(\d+)(?:/\d+)?\s+(\d{1,2}-[A-Za-z]{3}-\d{4})\s+(\d{1,2}:\d{2}(?::\d{2})?)(?:\.\d+)?(?:\s+\[([^\]]*)\])?(?:\s+\(([^)]*)\))?`)
+
+func parseVMS(line string) (Entry, bool) {
+	m := VMS_LINE.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false
+	}
+	e := Entry{Format: "vms", Name: m[1], Type: FILE, Permissions: m[7]}
+	if strings.HasSuffix(strings.ToUpper(e.Name), ".DIR") {
+		e.Name, e.Type = e.Name[:len(e.Name)-4], DIR
+	}
+	blocks, _ := strconv.ParseInt(m[3], 10, 64)
+	e.Size = blocks * 512
+	for _, layout := range []string{"2-Jan-2006 15:04:05", "2-Jan-2006 15:04"} {
+		if t, err := time.Parse(layout, m[4]+" "+m[5]); err == nil {
+			e.Time = t
+			break
+		}
+	}
+	// [GROUP,OWNER] or a single identifier [OWNER]
+	if owner := strings.SplitN(m[6], ",", 2); len(owner) == 2 {
+		e.Group, e.Owner = owner[0], owner[1]
+	} else {
+		e.Owner = m[6]
+	}
+	return e, true
+}
+
+func splitFields(line string) []field {
+	fields := []field{}
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		blank := i == len(line) || line[i] == ' ' || line[i] == '\t'
+		if blank && start >= 0 {
+			fields = append(fields, field{line[start:i], i})
+			start = -1
+		} else if !blank && start < 0 {
+			start = i
+		}
+	}
+	return fields
+}
+
+func monthOf(str string) time.Month {
+	return MONTHS[strings.ToLower(str)]
+}
+
+func isNumber(str string) bool {
+	_, err := strconv.ParseUint(str, 10, 64)
+	return err == nil
+}
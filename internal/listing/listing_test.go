@@ -0,0 +1,152 @@
+package listing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var NOW = time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+// describe gives the fields of an entry as format|type|name|size|time|permissions|owner|group|target
+func describe(e Entry) string {
+	t := ""
+	if !e.Time.IsZero() {
+		t = e.Time.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("%s|%s|%s|%d|%s|%s|%s|%s|%s", e.Format, e.Type, e.Name, e.Size, t, e.Permissions, e.Owner, e.Group, e.Target)
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want string
+	}{
+		// vsftpd
+		{"-rw-r--r--    1 ftp      ftp          1024 Jan 02  2020 notes.txt", "unix|file|notes.txt|1024|2020-01-02 00:00:00|rw-r--r--|ftp|ftp|"},
+		{"drwxr-xr-x    2 ftp      ftp          4096 Mar 14 09:26 pub", "unix|dir|pub|4096|2024-03-14 09:26:00|rwxr-xr-x|ftp|ftp|"},
+		{"lrwxrwxrwx    1 ftp      ftp            19 Jun 15  2019 latest -> releases/2019-06-15", "unix|link|latest|19|2019-06-15 00:00:00|rwxrwxrwx|ftp|ftp|releases/2019-06-15"},
+		// numeric owners as servers without the users of the files have
+		{"-rw-r--r--    1 1000     1000     734003200 Oct 01  2023 debian-12.iso", "unix|file|debian-12.iso|734003200|2023-10-01 00:00:00|rw-r--r--|1000|1000|"},
+		{"-rw-rw-r--    1 0        0               0 Nov  5 23:59 .hidden", "unix|file|.hidden|0|2023-11-05 23:59:00|rw-rw-r--|0|0|"},
+		// names with spaces, arrows that aren't links and dates in the name
+		{"-rw-r--r--   1 owner  group      12 Feb  1 10:00 my  file (1).txt", "unix|file|my  file (1).txt|12|2024-02-01 10:00:00|rw-r--r--|owner|group|"},
+		{"-rw-r--r--   1 owner  group      12 Feb  1  2021 a -> b.txt", "unix|file|a -> b.txt|12|2021-02-01 00:00:00|rw-r--r--|owner|group|"},
+		{"-rw-r--r--   1 owner  group      12 Feb  1  2021 backup Jan 2 2020.tar", "unix|file|backup Jan 2 2020.tar|12|2021-02-01 00:00:00|rw-r--r--|owner|group|"},
+		// ProFTPD with a small size that could pass for a day
+		{"-rw-r--r--   1 1000     1000           12 Jan 10 10:30 small", "unix|file|small|12|2024-01-10 10:30:00|rw-r--r--|1000|1000|"},
+		// year-less dates are in the past: june 16 is tomorrow so within the margin, december is last year
+		{"-rw-r--r--   1 ftp ftp 1 Jun 16 08:00 tomorrow", "unix|file|tomorrow|1|2024-06-16 08:00:00|rw-r--r--|ftp|ftp|"},
+		{"-rw-r--r--   1 ftp ftp 1 Dec 24 18:00 christmas", "unix|file|christmas|1|2023-12-24 18:00:00|rw-r--r--|ftp|ftp|"},
+		{"-rw-r--r--   1 ftp ftp 1 Feb 29 18:00 leap", "unix|file|leap|1|2024-02-29 18:00:00|rw-r--r--|ftp|ftp|"},
+		// devices, pipes and sockets
+		{"crw-rw-rw-   1 root     root       1,   3 Jan  1  2020 null", "unix|other|null|-1|2020-01-01 00:00:00|rw-rw-rw-|root|root|"},
+		{"brw-rw----   1 root     disk       8,0 Apr  2 12:00 sda", "unix|other|sda|-1|2024-04-02 12:00:00|rw-rw----|root|disk|"},
+		{"prw-r--r--   1 root     root          0 May  3 13:14 fifo", "unix|other|fifo|0|2024-05-03 13:14:00|rw-r--r--|root|root|"},
+		{"srwxrwxrwx   1 root     root          0 May  3 13:14 socket", "unix|other|socket|0|2024-05-03 13:14:00|rwxrwxrwx|root|root|"},
+		// setuid, sticky bits, ACL and extended attribute marks
+		{"-rwsr-xr-x   1 root     root      54256 Mar 27  2022 passwd", "unix|file|passwd|54256|2022-03-27 00:00:00|rwsr-xr-x|root|root|"},
+		{"drwxrwxrwt   7 root     root       4096 Jun 14 06:25 tmp", "unix|dir|tmp|4096|2024-06-14 06:25:00|rwxrwxrwt|root|root|"},
+		{"drwxr-xr-x+  3 user     staff        96 Jun  1 09:00 acl", "unix|dir|acl|96|2024-06-01 09:00:00|rwxr-xr-x|user|staff|"},
+		{"-rw-r--r--@  1 user     staff      6148 Jun  1 09:00 .DS_Store", "unix|file|.DS_Store|6148|2024-06-01 09:00:00|rw-r--r--|user|staff|"},
+		{"-rw-r--r--.  1 root     root        123 Jun  1 09:00 selinux", "unix|file|selinux|123|2024-06-01 09:00:00|rw-r--r--|root|root|"},
+		// servers without the group, or without the number of links
+		{"-rw-r--r--   1 owner          1024 Jan  2  2020 nogroup", "unix|file|nogroup|1024|2020-01-02 00:00:00|rw-r--r--|owner||"},
+		{"drwxr-xr-x   folder        0 Jan  2  2020 nolinks", "unix|dir|nolinks|0|2020-01-02 00:00:00|rwxr-xr-x|folder||"},
+		{"-rw-r--r-- 1 owner group 1024 Jan 2 2020 tight", "unix|file|tight|1024|2020-01-02 00:00:00|rw-r--r--|owner|group|"},
+		// FileZilla Server and Windows servers in unix mode
+		{"-rw-r--r-- 1 ftp ftp         179200 Sep 13  2018 setup.exe", "unix|file|setup.exe|179200|2018-09-13 00:00:00|rw-r--r--|ftp|ftp|"},
+		{"drwxrwxrwx   1 owner    group               0 Dec  1 12:00 Program Files", "unix|dir|Program Files|0|2023-12-01 12:00:00|rwxrwxrwx|owner|group|"},
+		// Synology, QNAP and other NAS with day first or upper case months
+		{"-rw-r--r-- 1 admin users 2048 15 Mar 2021 photo.jpg", "unix|file|photo.jpg|2048|2021-03-15 00:00:00|rw-r--r--|admin|users|"},
+		{"-rw-r--r-- 1 admin users 2048 MAR 15 2021 PHOTO.JPG", "unix|file|PHOTO.JPG|2048|2021-03-15 00:00:00|rw-r--r--|admin|users|"},
+		// ls --time-style=long-iso and full-iso
+		{"-rw-r--r-- 1 user group 5 2021-04-05 06:07 iso.txt", "unix|file|iso.txt|5|2021-04-05 06:07:00|rw-r--r--|user|group|"},
+		{"-rw-r--r-- 1 user group 5 2021-04-05 06:07:08.123456789 +0200 full.txt", "unix|file|full.txt|5|2021-04-05 06:07:08|rw-r--r--|user|group|"},
+		// huge files and tabs
+		{"-rw-r--r--   1 ftp      ftp      107374182400 Jan  1  2024 huge.img", "unix|file|huge.img|107374182400|2024-01-01 00:00:00|rw-r--r--|ftp|ftp|"},
+		{"-rw-r--r--\t1\tftp\tftp\t10\tJan\t1\t2024\ttabs", "unix|file|tabs|10|2024-01-01 00:00:00|rw-r--r--|ftp|ftp|"},
+
+		// IIS and windows
+		{"01-02-20  03:04PM       <DIR>          pub", "dos|dir|pub|-1|2020-01-02 15:04:00||||"},
+		{"10-23-19  11:15AM               123456 readme.txt", "dos|file|readme.txt|123456|2019-10-23 11:15:00||||"},
+		{"12-31-99  12:00AM                    0 y2k.txt", "dos|file|y2k.txt|0|1999-12-31 00:00:00||||"},
+		{"06-15-24  12:30PM                    1 noon.txt", "dos|file|noon.txt|1|2024-06-15 12:30:00||||"},
+		{"01-02-2020  15:04       <DIR>          four digit year", "dos|dir|four digit year|-1|2020-01-02 15:04:00||||"},
+		{"04/05/2021  06:07 PM    1,234,567 slashes.zip", "dos|file|slashes.zip|1234567|2021-04-05 18:07:00||||"},
+		{"07-08-21  09:10AM       <JUNCTION>     Documents", "dos|dir|Documents|-1|2021-07-08 09:10:00||||"},
+		{"02-03-22  04:05AM                 2048   leading spaces.txt", "dos|file|leading spaces.txt|2048|2022-02-03 04:05:00||||"},
+
+		// EPLF
+		{"+i8388621.29609,m824255902,/,\tdev", "eplf|dir|dev|-1|1996-02-13 23:58:22||||"},
+		{"+i8388621.44468,m839956783,r,s10376,\tRFCEPLF", "eplf|file|RFCEPLF|10376|1996-08-13 17:19:43||||"},
+		{"+i8388621.48594,m825718503,r,s280,up644,\tdjb.html", "eplf|file|djb.html|280|1996-03-01 22:15:03|644|||"},
+		{"+m825718503,s0,\tunknown", "eplf|other|unknown|0|1996-03-01 22:15:03||||"},
+
+		// VMS
+		{"README.TXT;1          2/4         2-JAN-2020 03:04:05  [GROUP,OWNER]  (RWED,RWED,RE,)", "vms|file|README.TXT|1024|2020-01-02 03:04:05|RWED,RWED,RE,|OWNER|GROUP|"},
+		{"SUBDIR.DIR;1          1/3        15-MAR-2019 10:20     [SYSTEM]       (RWE,RWE,RE,RE)", "vms|dir|SUBDIR|512|2019-03-15 10:20:00|RWE,RWE,RE,RE|SYSTEM||"},
+		{"LOGIN.COM;12          4          1-APR-2001 00:00:00.00  [ANON]  (RWED,RWED,,)", "vms|file|LOGIN.COM|2048|2001-04-01 00:00:00|RWED,RWED,,|ANON||"},
+		{"DATA.BIN;3         1000          7-JUL-2007 07:07", "vms|file|DATA.BIN|512000|2007-07-07 07:07:00||||"},
+	} {
+		e, ok := Parse(tc.line, NOW)
+		if got := describe(e); !ok || got != tc.want {
+			t.Errorf("Parse(%q) = %v %q, want %q", tc.line, ok, got, tc.want)
+		}
+	}
+}
+
+func TestParseNotEntries(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"total 1234",
+		"total 0",
+		"   ",
+		"Directory DISK$USER:[ANONYMOUS]",
+		"Total of 12 files, 345/678 blocks.",
+		"Grand total of 1 directory, 12 files, 345/678 blocks.",
+		"drwxr-xr-x   2 ftp ftp 4096 Jan  2  2020",
+		"-rw-r--r--   1 ftp ftp  big Jan  2  2020 nosize",
+		"-rw-r--r--   1 ftp ftp 1024 Foo  2  2020 nomonth",
+		"-rw-r--r--   1 ftp ftp 1024 Jan 32  2020 noday",
+		"xrw-r--r--   1 ftp ftp 1024 Jan  2  2020 notamode",
+		"+i8388621.29609,m824255902,/,",
+		"13-45-20  03:04PM       <DIR>          nodate",
+		"README.TXT;1  lost",
+		"550 Permission denied.",
+	} {
+		if e, ok := Parse(line, NOW); ok {
+			t.Errorf("Parse(%q) = %q", line, describe(e))
+		}
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	entries := ParseLines([]string{
+		"total 8",
+		"drwxr-xr-x    2 ftp      ftp          4096 Jan 02  2020 .",
+		"drwxr-xr-x    5 ftp      ftp          4096 Jan 02  2020 ..",
+		"-rw-r--r--    1 ftp      ftp          1024 Jan 02  2020 notes.txt",
+		"",
+		"Directory ANONYMOUS$ROOT:[000000]",
+		"",
+		"A_RATHER_LONG_FILE_NAME_THAT_DOES_NOT_FIT.TXT;1",
+		"                       3/3         2-JAN-2020 03:04:05  [ANON]  (RWED,RWED,RE,)",
+		"SHORT.TXT;1            1/3         2-JAN-2020 03:04:05  [ANON]  (RWED,RWED,RE,)",
+		"",
+		"Total of 2 files, 4/6 blocks.",
+	}, NOW)
+	want := []string{
+		"unix|file|notes.txt|1024|2020-01-02 00:00:00|rw-r--r--|ftp|ftp|",
+		"vms|file|A_RATHER_LONG_FILE_NAME_THAT_DOES_NOT_FIT.TXT|1536|2020-01-02 03:04:05|RWED,RWED,RE,|ANON||",
+		"vms|file|SHORT.TXT|512|2020-01-02 03:04:05|RWED,RWED,RE,|ANON||",
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("ParseLines gave %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if got := describe(e); got != want[i] {
+			t.Errorf("ParseLines entry %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
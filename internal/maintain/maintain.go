@@ -0,0 +1,122 @@
+package maintain
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+	"github.com/mickael-kerjean/ftpscan/internal/explore"
+	"github.com/mickael-kerjean/ftpscan/internal/shutdown"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"os"
+	"time"
+)
+
+// how long we wait before checking a host again depends on what it was the last time.
+// Hosts that couldn't be reached wait twice as long after each failure, up to MAX_BACKOFF
+var (
+	ANONYMOUS   time.Duration = 7 * 24 * time.Hour
+	AVAILABLE   time.Duration = 14 * 24 * time.Hour
+	OTHER       time.Duration = 30 * 24 * time.Hour
+	UNREACHABLE time.Duration = 30 * 24 * time.Hour
+	MAX_BACKOFF time.Duration = 180 * 24 * time.Hour
+	BUDGET      int           = 10000
+	DRY_RUN     bool          = false
+)
+
+// Cmd is the maintain phase: check again the hosts we haven't heard of for a while
+func Cmd(args []string) {
+	fs := flag.NewFlagSet("maintain", flag.ExitOnError)
+	fs.IntVar(&BUDGET, "budget", BUDGET, "maximum number of hosts checked by this run")
+	fs.BoolVar(&DRY_RUN, "dry-run", DRY_RUN, "list the hosts due for a check without checking them")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan maintain [-budget n] [-dry-run]
+
+Hosts are checked again once they're due according to their last status: every %s
+for the anonymous ones, %s for the other ftp servers and %s for the rest. Hosts that
+couldn't be reached wait %s, twice as long after each failure in a row, up to %s.
+Those intervals are set in the [maintain] section of the config file.
+
+The most overdue hosts go first and a run stops after -budget hosts so it can run from
+cron. The probe is the one of the explore phase, with its settings: the details of a host
+are refreshed and each check is kept in the observation table.
+`, ANONYMOUS, AVAILABLE, OTHER, UNREACHABLE, MAX_BACKOFF)
+	}
+	fs.Parse(args)
+	if err := Settings().Validate(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	} else if err := explore.Settings().Validate(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	} else if err := storage.Open(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer storage.DB.Close()
+	config.Print("maintain", Settings())
+	rows, err := storage.DB.Query(DUE_QUERY,
+		seconds(ANONYMOUS), seconds(AVAILABLE), seconds(UNREACHABLE),
+		seconds(MAX_BACKOFF), seconds(OTHER), BUDGET,
+	)
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer rows.Close()
+	if DRY_RUN {
+		fmt.Printf("ip\tport\tlast_status\tchecked_at\tfailures\n")
+		for rows.Next() {
+			var ip, status, checked string
+			var port, failures int
+			rows.Scan(&ip, &port, &status, &checked, &failures)
+			fmt.Printf("%s\t%d\t%s\t%s\t%d\n", ip, port, status, checked, failures)
+		}
+		return
+	}
+
+	config.Print("explore", explore.Settings())
+	shutdown.Handle()
+	writer := storage.NewWriter()
+	if err := explore.Start(writer); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	checked := 0
+	for rows.Next() && !shutdown.Stopped() {
+		var ip, status, at string
+		var port, failures int
+		rows.Scan(&ip, &port, &status, &at, &failures)
+		explore.Push(net.ParseIP(ip), port)
+		checked++
+	}
+	rows.Close()
+	explore.Wait()
+	if err := writer.Close(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+	}
+	fmt.Printf("> %d hosts checked\n", checked)
+	fmt.Printf("> writes: %s\n", writer.String())
+	if shutdown.Stopped() {
+		storage.DB.Close()
+		os.Exit(1)
+	}
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d.Seconds())
+}
+
+// DUE_QUERY gives the hosts due for a check, the most overdue first. A host that failed n
+// times in a row waits UNREACHABLE * 2^(n-1), the shift is capped to stay in an integer
+const DUE_QUERY = `SELECT ip, port, last_status, checked_at, failures FROM (
+  SELECT ip, port, COALESCE(last_status, '') AS last_status, COALESCE(checked_at, timestamp) AS checked_at, failures,
+    datetime(COALESCE(checked_at, timestamp), '+' || CASE last_status
+      WHEN 'anonymous' THEN $1
+      WHEN 'available' THEN $2
+      WHEN 'unreachable' THEN MIN($3 << MIN(MAX(failures - 1, 0), 32), $4)
+      ELSE $5
+    END || ' seconds') AS due
+  FROM host
+) WHERE due <= datetime('now') ORDER BY due LIMIT $6`
@@ -0,0 +1,63 @@
+package maintain
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDue(t *testing.T) {
+	defer func(path string) { storage.PATH = path }(storage.PATH)
+	storage.PATH = filepath.Join(t.TempDir(), "ftp.sqlite")
+	if err := storage.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.DB.Close()
+	ago := func(d time.Duration) string { return time.Now().UTC().Add(-d).Format(storage.TIMESTAMP) }
+	day := 24 * time.Hour
+	for _, h := range []struct {
+		ip       string
+		status   string
+		checked  string
+		failures int
+	}{
+		{"10.0.0.1", "anonymous", ago(8 * day), 0},     // a day overdue
+		{"10.0.0.2", "anonymous", ago(6 * day), 0},     // not yet
+		{"10.0.0.3", "available", ago(20 * day), 0},    // 6 days overdue
+		{"10.0.0.4", "unreachable", ago(31 * day), 1},  // first failure: 30 days
+		{"10.0.0.5", "unreachable", ago(50 * day), 2},  // second failure: 60 days
+		{"10.0.0.6", "unreachable", ago(200 * day), 9}, // capped to 180 days
+		{"10.0.0.7", "open", ago(40 * day), 0},         // 10 days overdue
+	} {
+		if _, err := storage.DB.Exec(
+			"INSERT INTO host(ip, port, last_status, checked_at, failures) VALUES($1, 21, $2, $3, $4)",
+			h.ip, h.status, h.checked, h.failures,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	due := func(budget int) []string {
+		rows, err := storage.DB.Query(DUE_QUERY,
+			seconds(ANONYMOUS), seconds(AVAILABLE), seconds(UNREACHABLE), seconds(MAX_BACKOFF), seconds(OTHER), budget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		ips := []string{}
+		for rows.Next() {
+			var ip, status, checked string
+			var port, failures int
+			rows.Scan(&ip, &port, &status, &checked, &failures)
+			ips = append(ips, ip)
+		}
+		return ips
+	}
+	if got, want := due(100), []string{"10.0.0.6", "10.0.0.7", "10.0.0.3", "10.0.0.1", "10.0.0.4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("due = %v, want %v", got, want)
+	}
+	if got := due(2); len(got) != 2 {
+		t.Errorf("budget of 2 gave %v", got)
+	}
+}
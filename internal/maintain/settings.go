@@ -0,0 +1,23 @@
+package maintain
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+)
+
+// Settings gives the current settings of the maintain phase
+func Settings() config.Maintain {
+	return config.Maintain{
+		Anonymous:   config.Duration{Duration: ANONYMOUS},
+		Available:   config.Duration{Duration: AVAILABLE},
+		Other:       config.Duration{Duration: OTHER},
+		Unreachable: config.Duration{Duration: UNREACHABLE},
+		MaxBackoff:  config.Duration{Duration: MAX_BACKOFF},
+		Budget:      BUDGET,
+	}
+}
+
+// Configure applies the settings of the config file, the flags have the last word
+func Configure(c config.Maintain) {
+	ANONYMOUS, AVAILABLE, OTHER = c.Anonymous.Duration, c.Available.Duration, c.Other.Duration
+	UNREACHABLE, MAX_BACKOFF, BUDGET = c.Unreachable.Duration, c.MaxBackoff.Duration, c.Budget
+}
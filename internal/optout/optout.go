@@ -0,0 +1,130 @@
+package optout
+
+import (
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// the registry is read again every REFRESH and on SIGHUP, new entries have to be honoured
+// by the phases already running
+var (
+	REFRESH  time.Duration = time.Minute
+	registry atomic.Value
+	watch    sync.Once
+)
+
+type networks struct {
+	// v4 is sorted and without overlaps so it can be searched
+	v4 [][2]uint32
+	v6 []*net.IPNet
+}
+
+// Load reads the networks whose owner asked not to be scanned, the registry is managed
+// with: ftpscan optout add
+func Load() error {
+	rows, err := storage.DB.Query("SELECT network, ip_from, ip_to FROM optout")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	n := networks{}
+	for rows.Next() {
+		var network string
+		var r [2]uint32
+		if err = rows.Scan(&network, &r[0], &r[1]); err != nil {
+			return err
+		}
+		// ipv6 networks don't fit in ip_from and ip_to
+		if strings.Contains(network, ":") {
+			net6, err := ParseIP6Net(network)
+			if err != nil {
+				return err
+			}
+			n.v6 = append(n.v6, net6)
+			continue
+		}
+		n.v4 = append(n.v4, r)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	n.v4 = normalize(n.v4)
+	registry.Store(n)
+	return nil
+}
+
+// Watch keeps the registry up to date until the process exits, it can be called by every
+// phase of the process
+func Watch() {
+	watch.Do(func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP)
+		tick := time.NewTicker(REFRESH)
+		go func() {
+			for {
+				select {
+				case <-sig:
+				case <-tick.C:
+				}
+				if err := Load(); err != nil {
+					fmt.Printf("\n[optout::reload error %s]\n", err.Error())
+				}
+			}
+		}()
+	})
+}
+
+// Contains tells if ip is in a network of the registry
+func Contains(ip net.IP) bool {
+	n, _ := registry.Load().(networks)
+	ip4 := ip.To4()
+	if ip4 == nil {
+		for _, net6 := range n.v6 {
+			if net6.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	i := uint32(ip4[0])<<24 | uint32(ip4[1])<<16 | uint32(ip4[2])<<8 | uint32(ip4[3])
+	j := sort.Search(len(n.v4), func(j int) bool { return n.v4[j][1] >= i })
+	return j < len(n.v4) && n.v4[j][0] <= i
+}
+
+// ParseIP6Net reads an ipv6 address or prefix
+func ParseIP6Net(str string) (*net.IPNet, error) {
+	if !strings.Contains(str, "/") {
+		str += "/128"
+	}
+	ip, network, err := net.ParseCIDR(str)
+	if err != nil || ip.To4() != nil {
+		return nil, fmt.Errorf("invalid ipv6 network '%s'", str)
+	} else if !ip.Equal(network.IP) {
+		return nil, fmt.Errorf("host bits set in '%s'", str)
+	}
+	return network, nil
+}
+
+func normalize(ranges [][2]uint32) [][2]uint32 {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	out := [][2]uint32{}
+	for _, r := range ranges {
+		if last := len(out) - 1; last >= 0 && uint64(r[0]) <= uint64(out[last][1])+1 {
+			if r[1] > out[last][1] {
+				out[last][1] = r[1]
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package optout
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContains(t *testing.T) {
+	defer func(path string) { storage.PATH = path }(storage.PATH)
+	storage.PATH = filepath.Join(t.TempDir(), "ftp.sqlite")
+	if err := storage.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.DB.Close()
+	add := func(network string, from, to uint32) {
+		if _, err := storage.DB.Exec(
+			"INSERT INTO optout(network, ip_from, ip_to, requester, requested_at) VALUES($1, $2, $3, 'test', '2024-01-01')",
+			network, from, to,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("8.8.8.0/24", 0x08080800, 0x080808ff)
+	add("8.8.8.128/25", 0x08080880, 0x080808ff)
+	add("1.1.1.1", 0x01010101, 0x01010101)
+	add("2001:4860::/32", 0, 0)
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"8.8.8.0": true, "8.8.8.200": true, "8.8.9.0": false, "8.8.7.255": false,
+		"1.1.1.1": true, "1.1.1.2": false, "1.1.1.0": false,
+		"2001:4860::8888": true, "2001:4861::1": false, "::ffff:8.8.8.8": true,
+	} {
+		if got := Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// networks registered while a phase is running get honoured
+	defer func(d time.Duration) { REFRESH = d }(REFRESH)
+	REFRESH = 10 * time.Millisecond
+	Watch()
+	add("9.9.9.0/24", 0x09090900, 0x090909ff)
+	for deadline := time.Now().Add(time.Second); !Contains(net.ParseIP("9.9.9.9")); {
+		if time.Now().After(deadline) {
+			t.Fatal("the registry wasn't refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
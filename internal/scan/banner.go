@@ -0,0 +1,60 @@
+package scan
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	BANNER         bool          = false
+	BANNER_SIZE    int           = 512
+	BANNER_TIMEOUT time.Duration = 3 * time.Second
+)
+
+// readBanner grabs the greeting a server sends as soon as we're connected. We stop reading
+// at the first complete reply, after BANNER_SIZE bytes or once BANNER_TIMEOUT is elapsed,
+// whatever comes first
+func readBanner(conn net.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(BANNER_TIMEOUT))
+	buf := make([]byte, BANNER_SIZE)
+	n := 0
+	for n < len(buf) {
+		c, err := conn.Read(buf[n:])
+		n += c
+		if err != nil || isCompleteReply(buf[:n]) {
+			break
+		}
+	}
+	return strings.ToValidUTF8(string(buf[:n]), "?")
+}
+
+// isCompleteReply tells if we've received a whole reply, which is either a single line
+// "220 hello" or a multi line "220-" reply closed by a "220 " line. Services that aren't
+// ftp are done after their first line
+func isCompleteReply(b []byte) bool {
+	if !bytes.HasSuffix(b, []byte("\n")) {
+		return false
+	}
+	lines := bytes.Split(bytes.TrimRight(b, "\r\n"), []byte("\n"))
+	first, last := lines[0], lines[len(lines)-1]
+	if !looksLikeFTP(string(first)) {
+		return true
+	}
+	return len(last) >= 4 && last[3] == ' ' && bytes.Equal(first[:3], last[:3])
+}
+
+// looksLikeFTP tells if a banner is the greeting of an ftp server: a 3 digits reply code
+// followed by a space or a dash. RFC 959 allows 120, 220 and 421 as greetings
+func looksLikeFTP(banner string) bool {
+	if len(banner) < 4 || (banner[0] != '1' && banner[0] != '2' && banner[0] != '4') {
+		return false
+	}
+	for i := 1; i < 3; i++ {
+		if banner[i] < '0' || banner[i] > '9' {
+			return false
+		}
+	}
+	return banner[3] == ' ' || banner[3] == '-'
+}
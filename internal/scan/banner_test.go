@@ -0,0 +1,65 @@
+package scan
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadBanner(t *testing.T) {
+	defer func(d time.Duration) { BANNER_TIMEOUT = d }(BANNER_TIMEOUT)
+	BANNER_TIMEOUT = 200 * time.Millisecond
+	for _, tc := range []struct {
+		sent string
+		want string
+	}{
+		{"220 ProFTPD Server ready.\r\n", "220 ProFTPD Server ready.\r\n"},
+		{"220-Welcome\r\n220-to our server\r\n220 ready\r\n", "220-Welcome\r\n220-to our server\r\n220 ready\r\n"},
+		{"SSH-2.0-OpenSSH_8.9\r\n", "SSH-2.0-OpenSSH_8.9\r\n"},
+		{"", ""},
+	} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(sent string) {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// the rest of a reply comes in a later packet
+			for _, part := range []string{sent[:len(sent)/2], sent[len(sent)/2:]} {
+				c.Write([]byte(part))
+				time.Sleep(20 * time.Millisecond)
+			}
+			time.Sleep(time.Second)
+			c.Close()
+		}(tc.sent)
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readBanner(conn); got != tc.want {
+			t.Errorf("readBanner(%q) = %q, want %q", tc.sent, got, tc.want)
+		}
+		conn.Close()
+		l.Close()
+	}
+}
+
+func TestLooksLikeFTP(t *testing.T) {
+	for banner, want := range map[string]bool{
+		"220 ready":           true,
+		"220-Welcome":         true,
+		"120 wait a minute":   true,
+		"421 too many users":  true,
+		"530 not allowed":     false,
+		"SSH-2.0-OpenSSH_8.9": false,
+		"HTTP/1.1 400":        false,
+		"22":                  false,
+	} {
+		if got := looksLikeFTP(banner); got != want {
+			t.Errorf("looksLikeFTP(%q) = %v, want %v", banner, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package scan
+
+import (
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/optout"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	BLOCKLIST_FILE string = ""
+	blocklist      atomic.Value
+)
+
+type blocklistData struct {
+	v4 ipSet
+	v6 ip6Set
+}
+
+// IANA special purpose registry (RFC 6890 and its updates). Nothing in there is reachable
+// from the public internet so we never want to dial it
+var RESERVED = mustIPSet(`
+0.0.0.0/8           # this network
+10.0.0.0/8          # private use
+100.64.0.0/10       # shared address space
+127.0.0.0/8         # loopback
+169.254.0.0/16      # link local
+172.16.0.0/12       # private use
+192.0.0.0/24        # ietf protocol assignments
+192.0.2.0/24        # documentation TEST-NET-1
+192.31.196.0/24     # AS112-v4
+192.52.193.0/24     # AMT
+192.88.99.0/24      # deprecated 6to4 relay anycast
+192.168.0.0/16      # private use
+192.175.48.0/24     # direct delegation AS112 service
+198.18.0.0/15       # benchmarking
+198.51.100.0/24     # documentation TEST-NET-2
+203.0.113.0/24      # documentation TEST-NET-3
+224.0.0.0/4         # multicast
+240.0.0.0/4         # reserved for future use
+255.255.255.255/32  # limited broadcast
+`)
+
+// the ipv6 counterpart of the registry, anything outside of global unicast (2000::/3) is
+// also ignored
+var RESERVED6 = mustIP6Set(`
+2001::/23           # ietf protocol assignments
+2001:db8::/32       # documentation
+2002::/16           # 6to4
+3fff::/20           # documentation
+`)
+
+// networks whose owners reported the scan
+var REPORTS = mustIPSet(`
+5.75.128.0/17
+23.88.0.0/17
+49.12.128.0/17
+49.13.0.0/16
+65.108.0.0/16
+65.109.0.0/16
+78.46.128.0/17
+78.47.0.0/16
+88.198.0.0/16
+91.107.0.0/17
+95.217.252.0/22
+128.140.0.0/17
+142.132.128.0/17
+162.55.200.0/21
+167.233.0.0/16
+168.119.208.0/20
+188.34.128.0/17
+213.133.0.0/17
+213.239.128.0/17
+`)
+
+func mustIPSet(str string) ipSet {
+	s, err := parseIPSet(strings.NewReader(str))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func mustIP6Set(str string) ip6Set {
+	_, s, err := parseNetworks(strings.NewReader(str), true)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// setupBlocklist loads the blocklist file along with the optout registry and reloads them
+// whenever the process receives a SIGHUP, which let us exclude new networks without
+// restarting a scan. The optout registry is also refreshed every minute as new entries
+// are expected to be honoured right away
+func setupBlocklist() error {
+	if err := loadBlocklist(); err != nil {
+		return err
+	} else if err := optout.Load(); err != nil {
+		return err
+	}
+	optout.Watch()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			if err := loadBlocklist(); err != nil {
+				fmt.Printf("\n[blocklist::reload error %s]\n", err.Error())
+				continue
+			}
+			b := blocklist.Load().(blocklistData)
+			fmt.Printf("\n[blocklist::reloaded %d ranges, %d ipv6 networks]\n", len(b.v4), len(b.v6))
+		}
+	}()
+	return nil
+}
+
+func loadBlocklist() error {
+	set := append(ipSet{}, REPORTS...)
+	set6 := ip6Set{}
+	if BLOCKLIST_FILE != "" {
+		s, s6, err := loadNetworks(BLOCKLIST_FILE)
+		if err != nil {
+			return err
+		}
+		set = append(set, s...)
+		set6 = append(set6, s6...)
+	}
+	blocklist.Store(blocklistData{set.normalize(), set6})
+	return nil
+}
+
+var globalUnicast = &net.IPNet{IP: net.ParseIP("2000::"), Mask: net.CIDRMask(3, 128)}
+
+func isBlocked(ip net.IP) bool {
+	b, _ := blocklist.Load().(blocklistData)
+	if optout.Contains(ip) {
+		return true
+	}
+	n, ok := ip2int(ip)
+	if !ok {
+		if ip.To16() == nil || !globalUnicast.Contains(ip) || RESERVED6.Contains(ip) {
+			return true
+		}
+		return b.v6.Contains(ip)
+	} else if RESERVED.Contains(n) {
+		return true
+	}
+	return b.v4.Contains(n)
+}
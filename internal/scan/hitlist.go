@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// an exhaustive scan of ipv6 is out of reach, instead we rely on hitlists: files with an
+// address or a small prefix on each line. Prefixes are expanded up to MAX_HITLIST_PREFIX
+// addresses. The position of an address is its index in the expanded hitlist
+const MAX_HITLIST_PREFIX = 65536
+
+func scanHitlist(queue chan target, path string, shard uint64, shards uint64) error {
+	if path == "-" {
+		return iterateHitlist(queue, os.Stdin, POSITION, shard, shards)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return iterateHitlist(queue, f, POSITION, shard, shards)
+}
+
+// iterateHitlist sends the addresses of a hitlist that belong to the shard, starting from
+// the given position. Invalid lines are reported and skipped as they shouldn't stop a
+// scan that has been running for days
+func iterateHitlist(queue chan target, r io.Reader, position uint64, shard uint64, shards uint64) error {
+	s := bufio.NewScanner(r)
+	var current uint64
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		ip, size, err := parseHitlistEntry(line)
+		if err != nil {
+			fmt.Printf("\n[hitlist::line %d: %s]\n", n, err.Error())
+			continue
+		}
+		if current+size <= position {
+			current += size
+			continue
+		}
+		for i := uint64(0); i < size; i++ {
+			if current >= position && current%shards == shard {
+				if current%65536 == 0 {
+					fmt.Printf("\n+>%d ", current)
+				}
+				queue <- target{ip, current}
+			}
+			ip = nextIP(ip)
+			current++
+		}
+	}
+	return s.Err()
+}
+
+func parseHitlistEntry(line string) (net.IP, uint64, error) {
+	if !strings.Contains(line, "/") {
+		ip := net.ParseIP(line)
+		if ip == nil {
+			return nil, 0, fmt.Errorf("invalid ip '%s'", line)
+		}
+		return normalizeIP(ip), 1, nil
+	}
+	ip, network, err := net.ParseCIDR(line)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid prefix '%s'", line)
+	} else if !ip.Equal(network.IP) {
+		return nil, 0, fmt.Errorf("host bits set in '%s'", line)
+	}
+	ones, total := network.Mask.Size()
+	if total-ones > 16 {
+		return nil, 0, fmt.Errorf("prefix '%s' is too large, at most %d addresses", line, MAX_HITLIST_PREFIX)
+	}
+	return normalizeIP(network.IP), uint64(1) << uint(total-ones), nil
+}
+
+// normalizeIP gives ipv4 addresses their 4 bytes form and ipv6 their 16 bytes form
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,231 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/optout"
+	"io"
+	"math/bits"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ipRange is an inclusive range of ipv4 addresses stored as integers
+type ipRange struct {
+	from uint32
+	to   uint32
+}
+
+// ipSet is a sorted list of non overlapping ranges
+type ipSet []ipRange
+
+// loadIPSet reads networks from a list of files, "-" being stdin. Each line is either
+// a single ip (1.2.3.4), a cidr (1.2.3.0/24) or a range (1.2.3.4-1.2.3.10). Anything
+// after a '#' is a comment
+func loadIPSet(paths ...string) (ipSet, error) {
+	set := ipSet{}
+	for _, path := range paths {
+		s, err := loadIPSetFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		set = append(set, s...)
+	}
+	return set.normalize(), nil
+}
+
+func loadIPSetFile(path string) (ipSet, error) {
+	if path == "-" {
+		return parseIPSet(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseIPSet(f)
+}
+
+func parseIPSet(r io.Reader) (ipSet, error) {
+	set, _, err := parseNetworks(r, false)
+	return set, err
+}
+
+// loadNetworks is the same as loadIPSet except ipv6 networks are accepted too
+func loadNetworks(path string) (ipSet, ip6Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	set, set6, err := parseNetworks(f, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return set, set6, nil
+}
+
+func parseNetworks(r io.Reader, allow6 bool) (ipSet, ip6Set, error) {
+	set := ipSet{}
+	set6 := ip6Set{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if allow6 && strings.Contains(line, ":") {
+			network, err := optout.ParseIP6Net(line)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+			set6 = append(set6, network)
+			continue
+		}
+		rng, err := parseIPRange(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+		set = append(set, rng)
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+	return set.normalize(), set6, nil
+}
+
+func parseIPRange(str string) (ipRange, error) {
+	if i := strings.Index(str, "/"); i != -1 {
+		from, ok := ip2int(net.ParseIP(str[:i]))
+		if !ok {
+			return ipRange{}, fmt.Errorf("invalid ip '%s'", str[:i])
+		}
+		size, err := strconv.Atoi(str[i+1:])
+		if err != nil || size < 0 || size > 32 {
+			return ipRange{}, fmt.Errorf("invalid prefix '%s'", str[i+1:])
+		}
+		hostmask := uint32(uint64(1)<<uint(32-size) - 1)
+		if from&hostmask != 0 {
+			return ipRange{}, fmt.Errorf("host bits set in '%s'", str)
+		}
+		return ipRange{from, from | hostmask}, nil
+	} else if i := strings.Index(str, "-"); i != -1 {
+		from, ok := ip2int(net.ParseIP(strings.TrimSpace(str[:i])))
+		if !ok {
+			return ipRange{}, fmt.Errorf("invalid ip '%s'", str[:i])
+		}
+		to, ok := ip2int(net.ParseIP(strings.TrimSpace(str[i+1:])))
+		if !ok {
+			return ipRange{}, fmt.Errorf("invalid ip '%s'", str[i+1:])
+		} else if to < from {
+			return ipRange{}, fmt.Errorf("empty range '%s'", str)
+		}
+		return ipRange{from, to}, nil
+	}
+	ip, ok := ip2int(net.ParseIP(str))
+	if !ok {
+		return ipRange{}, fmt.Errorf("invalid ip '%s'", str)
+	}
+	return ipRange{ip, ip}, nil
+}
+
+func (s ipSet) normalize() ipSet {
+	if len(s) == 0 {
+		return s
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].from < s[j].from })
+	out := ipSet{s[0]}
+	for _, r := range s[1:] {
+		last := &out[len(out)-1]
+		if uint64(r.from) <= uint64(last.to)+1 {
+			if r.to > last.to {
+				last.to = r.to
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func (s ipSet) Contains(ip uint32) bool {
+	i := sort.Search(len(s), func(i int) bool { return s[i].to >= ip })
+	return i < len(s) && s[i].from <= ip
+}
+
+func (s ipSet) Subtract(other ipSet) ipSet {
+	out := ipSet{}
+	j := 0
+	for _, r := range s {
+		from := uint64(r.from)
+		for ; j < len(other) && other[j].to < r.from; j++ {
+		}
+		for k := j; k < len(other) && other[k].from <= r.to; k++ {
+			if uint64(other[k].from) > from {
+				out = append(out, ipRange{uint32(from), other[k].from - 1})
+			}
+			from = uint64(other[k].to) + 1
+		}
+		if from <= uint64(r.to) {
+			out = append(out, ipRange{uint32(from), r.to})
+		}
+	}
+	return out
+}
+
+func (s ipSet) Size() uint64 {
+	var n uint64
+	for _, r := range s {
+		n += uint64(r.to) - uint64(r.from) + 1
+	}
+	return n
+}
+
+// cidrs split the set into the smallest list of prefixes covering it
+func (s ipSet) cidrs() []net.IPNet {
+	out := []net.IPNet{}
+	for _, r := range s {
+		for from := uint64(r.from); from <= uint64(r.to); {
+			size := bits.TrailingZeros64(from | 1<<32)
+			for from+(uint64(1)<<uint(size))-1 > uint64(r.to) {
+				size--
+			}
+			out = append(out, net.IPNet{
+				IP:   int2ip(uint32(from)),
+				Mask: net.CIDRMask(32-size, 32),
+			})
+			from += uint64(1) << uint(size)
+		}
+	}
+	return out
+}
+
+// ip6Set is a list of ipv6 networks. They only come from blocklists and the optout registry
+// which are small enough to be checked one by one
+type ip6Set []*net.IPNet
+
+func (s ip6Set) Contains(ip net.IP) bool {
+	for _, n := range s {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func ip2int(ip net.IP) (uint32, bool) {
+	if ip = ip.To4(); ip == nil {
+		return 0, false
+	}
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3]), true
+}
+
+func int2ip(n uint32) net.IP {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
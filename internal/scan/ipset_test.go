@@ -0,0 +1,187 @@
+package scan
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseIPRange(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		out ipRange
+		err string
+	}{
+		{"1.2.3.4", ipRange{0x01020304, 0x01020304}, ""},
+		{"10.0.0.0/8", ipRange{0x0a000000, 0x0affffff}, ""},
+		{"0.0.0.0/0", ipRange{0, 0xffffffff}, ""},
+		{"1.2.3.4/32", ipRange{0x01020304, 0x01020304}, ""},
+		{"1.2.3.4 - 1.2.3.10", ipRange{0x01020304, 0x0102030a}, ""},
+		{"95.217.252.2/22", ipRange{}, "host bits set"},
+		{"1.2.3.10-1.2.3.4", ipRange{}, "empty range"},
+		{"1.2.3.0/33", ipRange{}, "invalid prefix"},
+		{"1.2.3.0/x", ipRange{}, "invalid prefix"},
+		{"1.2.3/24", ipRange{}, "invalid ip"},
+		{"1.2.3.4-foo", ipRange{}, "invalid ip"},
+		{"::1", ipRange{}, "invalid ip"},
+	} {
+		out, err := parseIPRange(tc.in)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("parseIPRange(%q) error = %v, want %q", tc.in, err, tc.err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("parseIPRange(%q) unexpected error %v", tc.in, err)
+		} else if out != tc.out {
+			t.Errorf("parseIPRange(%q) = %v, want %v", tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestParseIPSet(t *testing.T) {
+	s, err := parseIPSet(strings.NewReader(`
+# comment
+10.0.0.4-10.0.0.9   # trailing comment
+10.0.0.0/30
+10.0.0.10
+
+1.1.1.1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ipSet{{0x01010101, 0x01010101}, {0x0a000000, 0x0a00000a}}
+	if !equalIPSet(s, want) {
+		t.Errorf("parseIPSet = %v, want %v", s, want)
+	}
+	if _, err := parseIPSet(strings.NewReader("1.1.1.1\nfoo\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("parseIPSet error = %v, want line number", err)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	full := ipSet{{0, 0xffffffff}}
+	for _, tc := range []struct {
+		name  string
+		set   ipSet
+		minus ipSet
+		want  ipSet
+	}{
+		{"nothing", ipSet{{10, 20}}, ipSet{}, ipSet{{10, 20}}},
+		{"start", ipSet{{10, 20}}, ipSet{{5, 12}}, ipSet{{13, 20}}},
+		{"end", ipSet{{10, 20}}, ipSet{{18, 30}}, ipSet{{10, 17}}},
+		{"middle", ipSet{{10, 20}}, ipSet{{12, 13}, {15, 15}}, ipSet{{10, 11}, {14, 14}, {16, 20}}},
+		{"everything", ipSet{{10, 20}}, ipSet{{10, 20}}, ipSet{}},
+		{"disjoint", ipSet{{10, 20}}, ipSet{{0, 9}, {21, 30}}, ipSet{{10, 20}}},
+		{"across ranges", ipSet{{10, 20}, {30, 40}}, ipSet{{15, 35}}, ipSet{{10, 14}, {36, 40}}},
+		{"full span start", full, ipSet{{0, 0}}, ipSet{{1, 0xffffffff}}},
+		{"full span end", full, ipSet{{0xffffff00, 0xffffffff}}, ipSet{{0, 0xfffffeff}}},
+		{"full span middle", full, ipSet{{0x0a000000, 0x0affffff}}, ipSet{{0, 0x09ffffff}, {0x0b000000, 0xffffffff}}},
+		{"full span minus full span", full, full, ipSet{}},
+	} {
+		if got := tc.set.Subtract(tc.minus); !equalIPSet(got, tc.want) {
+			t.Errorf("%s: Subtract = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCidrs(t *testing.T) {
+	s := ipSet{{0x0a000001, 0x0a000006}}
+	got := []string{}
+	for _, n := range s.cidrs() {
+		got = append(got, n.String())
+	}
+	want := "10.0.0.1/32 10.0.0.2/31 10.0.0.4/31 10.0.0.6/32"
+	if strings.Join(got, " ") != want {
+		t.Errorf("cidrs = %v, want %s", got, want)
+	}
+	if n := (ipSet{{0, 0xffffffff}}).cidrs(); len(n) != 1 || n[0].String() != "0.0.0.0/0" {
+		t.Errorf("cidrs of the full span = %v", n)
+	}
+}
+
+// the walk has to visit addresses in the same order the original octet reversed loops did
+func TestIterateThroughPublicIPs(t *testing.T) {
+	scope, err := parseIPSet(strings.NewReader(`
+1.2.3.0/24
+5.0.0.0/14
+8.8.8.8
+200.1.0.0-200.1.2.7
+255.255.255.254/31
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope = scope.Subtract(ipSet{{0x05010000, 0x0501ffff}})
+	for _, start := range []string{"0.0.0.0", "0.0.3.0", "7.1.2.0", "200.1.2.7", "1.2.3.255", "255.255.255.255"} {
+		CURRENT_IP = net.ParseIP(start)
+		want := octetReversedWalk(scope, CURRENT_IP.To4())
+		queue := make(chan target, len(want)+1)
+		iterateThroughPublicIPs(queue, scope)
+		close(queue)
+		i := 0
+		for tg := range queue {
+			ip := tg.ip
+			if i >= len(want) || !ip.Equal(want[i]) {
+				t.Fatalf("start %s: address #%d = %s, want %v", start, i, ip, want[i:])
+			}
+			i++
+		}
+		if i != len(want) {
+			t.Fatalf("start %s: visited %d addresses, want %d", start, i, len(want))
+		}
+	}
+	CURRENT_IP = net.IPv4(0, 0, 0, 0)
+}
+
+// octetReversedWalk mirrors the nested loops the scanner used before targets existed, with
+// each octet only going through the values that show up in the scope
+func octetReversedWalk(scope ipSet, start net.IP) []net.IP {
+	values := [4][]int{}
+	for o := 0; o < 4; o++ {
+		seen := map[int]bool{}
+		for _, r := range scope {
+			for n := uint64(r.from); n <= uint64(r.to); n++ {
+				seen[int(byte(n>>uint(24-8*o)))] = true
+			}
+		}
+		for v := 0; v <= 255; v++ {
+			if seen[v] {
+				values[o] = append(values[o], v)
+			}
+		}
+	}
+	// the loops start from the start ip and wrap back to 0 once they went through their first
+	// pass, meaning they only skip what comes before the start ip in (a0, a1, a2, a3) order
+	from := uint32(start[3])<<24 | uint32(start[2])<<16 | uint32(start[1])<<8 | uint32(start[0])
+	out := []net.IP{}
+	for _, a0 := range values[3] {
+		for _, a1 := range values[2] {
+			for _, a2 := range values[1] {
+				for _, a3 := range values[0] {
+					if uint32(a0)<<24|uint32(a1)<<16|uint32(a2)<<8|uint32(a3) < from {
+						continue
+					}
+					n := uint32(a3)<<24 | uint32(a2)<<16 | uint32(a1)<<8 | uint32(a0)
+					if scope.Contains(n) {
+						out = append(out, int2ip(n))
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+func equalIPSet(a, b ipSet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
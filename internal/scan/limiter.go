@@ -0,0 +1,253 @@
+package scan
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	RATE    float64 = 0
+	RATE_16 float64 = 0
+	RATE_24 float64 = 0
+	LIMITER         = newLimiter()
+)
+
+// limiter caps how many connection attempts we make per second, for the whole process as
+// well as for every /16 and /24 so no single network sees a burst. A rate of 0 means
+// no limit
+type limiter struct {
+	mu      sync.Mutex
+	global  *tokenBucket
+	rate16  float64
+	rate24  float64
+	net16   map[uint32]*tokenBucket
+	net24   map[uint32]*tokenBucket
+	janitor *time.Ticker
+}
+
+func newLimiter() *limiter {
+	l := &limiter{
+		global:  &tokenBucket{},
+		net16:   map[uint32]*tokenBucket{},
+		net24:   map[uint32]*tokenBucket{},
+		janitor: time.NewTicker(time.Minute),
+	}
+	go func() {
+		for range l.janitor.C {
+			l.cleanup()
+		}
+	}()
+	return l
+}
+
+func (l *limiter) SetRates(global float64, per16 float64, per24 float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.global.setRate(global)
+	if per16 != l.rate16 {
+		l.rate16 = per16
+		l.net16 = map[uint32]*tokenBucket{}
+	}
+	if per24 != l.rate24 {
+		l.rate24 = per24
+		l.net24 = map[uint32]*tokenBucket{}
+	}
+}
+
+func (l *limiter) Rates() (float64, float64, float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.global.getRate(), l.rate16, l.rate24
+}
+
+// Wait blocks until we're allowed to dial the given ip
+func (l *limiter) Wait(ip net.IP) {
+	n16, n24 := networkKeys(ip)
+	l.mu.Lock()
+	b16 := l.bucket(l.net16, n16, l.rate16)
+	b24 := l.bucket(l.net24, n24, l.rate24)
+	l.mu.Unlock()
+	b16.wait()
+	b24.wait()
+	l.global.wait()
+}
+
+// networkKeys identifies the /16 and /24 of an ip. Their ipv6 equivalent are the /48 and
+// the /56 which we hash down to the same size
+func networkKeys(ip net.IP) (uint32, uint32) {
+	if n, ok := ip2int(ip); ok {
+		return n & 0xffff0000, n & 0xffffff00
+	}
+	ip = ip.To16()
+	h48, h56 := fnv.New32a(), fnv.New32a()
+	h48.Write(ip[:6])
+	h56.Write(ip[:7])
+	return h48.Sum32(), h56.Sum32()
+}
+
+func (l *limiter) bucket(m map[uint32]*tokenBucket, network uint32, rate float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b, ok := m[network]
+	if !ok {
+		b = &tokenBucket{}
+		b.setRate(rate)
+		m[network] = b
+	}
+	return b
+}
+
+// cleanup forgets about networks we haven't touched for a while, their bucket would be
+// full anyway
+func (l *limiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range []map[uint32]*tokenBucket{l.net16, l.net24} {
+		for k, b := range m {
+			if b.idle(time.Minute) {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+// tokenBucket allows up to rate events per second with bursts of at most rate events
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setRate(rate float64) {
+	b.mu.Lock()
+	b.rate = rate
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) getRate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+func (b *tokenBucket) wait() {
+	if b == nil {
+		return
+	}
+	for {
+		b.mu.Lock()
+		if b.rate <= 0 {
+			b.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		if b.last.IsZero() {
+			b.tokens = 1
+		} else {
+			b.tokens += now.Sub(b.last).Seconds() * b.rate
+		}
+		burst := b.rate
+		if burst < 1 {
+			burst = 1
+		}
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(delay)
+	}
+}
+
+func (b *tokenBucket) idle(d time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Since(b.last) > d
+}
+
+func formatRate(rate float64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g/s", rate)
+}
+
+// RateCmd changes the rates of the scans that are running, they pick up the change within
+// a few seconds
+func RateCmd(args []string) {
+	fs := flag.NewFlagSet("rate", flag.ExitOnError)
+	per16 := fs.Float64("per16", -1, "connection attempts per second for each /16, 0 for unlimited")
+	per24 := fs.Float64("per24", -1, "connection attempts per second for each /24, 0 for unlimited")
+	id := fs.Int64("id", 0, "scan to update, every unfinished scan by default")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan rate [-id n] [-per16 rate] [-per24 rate] [global rate]
+`)
+	}
+	fs.Parse(args)
+	if err := storage.Open(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer storage.DB.Close()
+
+	updates := []string{}
+	values := []interface{}{}
+	if fs.NArg() > 0 {
+		rate, err := strconv.ParseFloat(fs.Arg(0), 64)
+		if err != nil || rate < 0 {
+			fmt.Printf("ERROR invalid rate '%s'\n", fs.Arg(0))
+			return
+		}
+		values = append(values, rate)
+		updates = append(updates, fmt.Sprintf("rate = $%d", len(values)))
+	}
+	if *per16 >= 0 {
+		values = append(values, *per16)
+		updates = append(updates, fmt.Sprintf("rate_16 = $%d", len(values)))
+	}
+	if *per24 >= 0 {
+		values = append(values, *per24)
+		updates = append(updates, fmt.Sprintf("rate_24 = $%d", len(values)))
+	}
+	where := fmt.Sprintf("(ended_at IS NULL AND $%d = 0) OR id = $%d", len(values)+1, len(values)+1)
+	if len(updates) > 0 {
+		if _, err := storage.DB.Exec("UPDATE scan_run SET "+strings.Join(updates, ", ")+" WHERE "+where, append(values, *id)...); err != nil {
+			fmt.Printf("ERROR %s\n", err.Error())
+			return
+		}
+	}
+	rows, err := storage.DB.Query("SELECT id, rate, rate_16, rate_24 FROM scan_run WHERE (ended_at IS NULL AND $1 = 0) OR id = $1", *id)
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n int64
+		var rate, rate16, rate24 float64
+		if err := rows.Scan(&n, &rate, &rate16, &rate24); err != nil {
+			fmt.Printf("ERROR %s\n", err.Error())
+			return
+		}
+		fmt.Printf("> scan #%d: %s, %s per /16, %s per /24\n", n, formatRate(rate), formatRate(rate16), formatRate(rate24))
+	}
+}
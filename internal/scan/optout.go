@@ -0,0 +1,158 @@
+package scan
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/optout"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+func OptoutCmd(args []string) {
+	usage := func() {
+		fmt.Printf(`
+Usage: ftpscan optout add [-date YYYY-MM-DD] network requester [reason]
+       ftpscan optout list
+       ftpscan optout export > optout.csv
+`)
+	}
+	if len(args) < 1 {
+		usage()
+		return
+	} else if err := storage.Open(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	defer storage.DB.Close()
+
+	var err error
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("optout add", flag.ExitOnError)
+		date := fs.String("date", time.Now().Format("2006-01-02"), "date of the request")
+		fs.Usage = usage
+		fs.Parse(args[1:])
+		if fs.NArg() < 2 {
+			usage()
+			return
+		}
+		err = optoutAdd(fs.Arg(0), fs.Arg(1), strings.Join(fs.Args()[2:], " "), *date)
+	case "list":
+		err = optoutList(false)
+	case "export":
+		err = optoutList(true)
+	default:
+		usage()
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+	}
+}
+
+func optoutAdd(network string, requester string, reason string, date string) error {
+	var (
+		rng  ipRange
+		net6 *net.IPNet
+		err  error
+	)
+	// ipv6 networks don't fit in ip_from and ip_to, they're read from the network column
+	if strings.Contains(network, ":") {
+		net6, err = optout.ParseIP6Net(network)
+	} else {
+		rng, err = parseIPRange(network)
+	}
+	if err != nil {
+		return err
+	} else if _, err = time.Parse("2006-01-02", date); err != nil {
+		return fmt.Errorf("invalid date '%s'", date)
+	}
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(
+		"INSERT INTO optout(network, ip_from, ip_to, requester, reason, requested_at) VALUES($1, $2, $3, $4, $5, $6)",
+		network, rng.from, rng.to, requester, reason, date,
+	); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return fmt.Errorf("'%s' is already registered", network)
+		}
+		return err
+	}
+
+	// ips are stored as text so the range check has to happen on our side
+	rows, err := tx.Query("SELECT ip FROM host")
+	if err != nil {
+		return err
+	}
+	purge := []string{}
+	for rows.Next() {
+		ip := ""
+		if err = rows.Scan(&ip); err != nil {
+			rows.Close()
+			return err
+		}
+		if net6 != nil {
+			if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil && net6.Contains(parsed) {
+				purge = append(purge, ip)
+			}
+		} else if n, ok := ip2int(net.ParseIP(ip)); ok && n >= rng.from && n <= rng.to {
+			purge = append(purge, ip)
+		}
+	}
+	rows.Close()
+	for _, ip := range purge {
+		for _, table := range storage.HOST_DEPENDENTS {
+			if _, err = tx.Exec("DELETE FROM "+table+" WHERE related_ip = $1", ip); err != nil {
+				return err
+			}
+		}
+		if _, err = tx.Exec("DELETE FROM host WHERE ip = $1", ip); err != nil {
+			return err
+		}
+	}
+	// certificates nobody presents anymore could tell who was behind the hosts
+	if _, err = tx.Exec("DELETE FROM certificate WHERE fingerprint NOT IN (SELECT fingerprint FROM host_certificate)"); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Printf("> %s registered, %d hosts purged\n", network, len(purge))
+	return nil
+}
+
+func optoutList(export bool) error {
+	rows, err := storage.DB.Query("SELECT network, requester, COALESCE(reason, ''), requested_at, timestamp FROM optout ORDER BY ip_from")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	w := csv.NewWriter(os.Stdout)
+	if export {
+		w.Write([]string{"network", "requester", "reason", "requested_at", "registered_at"})
+	}
+	for rows.Next() {
+		var network, requester, reason string
+		var requestedAt, registeredAt time.Time
+		if err = rows.Scan(&network, &requester, &reason, &requestedAt, &registeredAt); err != nil {
+			return err
+		}
+		if export {
+			w.Write([]string{network, requester, reason, requestedAt.Format("2006-01-02"), registeredAt.Format(time.RFC3339)})
+			continue
+		}
+		fmt.Printf("%-20s %s %-30s %s\n", network, requestedAt.Format("2006-01-02"), requester, reason)
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+	return rows.Err()
+}
@@ -0,0 +1,129 @@
+package scan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// outcome is what happened when dialing a port
+type outcome int
+
+const (
+	OUTCOME_OPEN outcome = iota
+	OUTCOME_REFUSED
+	OUTCOME_TIMEOUT
+	OUTCOME_UNREACHABLE
+	OUTCOME_RESET
+	OUTCOME_OTHER
+	outcomeCount
+)
+
+var outcomeNames = [outcomeCount]string{"open", "refused", "timeout", "unreachable", "reset", "other"}
+
+func (o outcome) String() string {
+	if o < 0 || o >= outcomeCount {
+		return "unknown"
+	}
+	return outcomeNames[o]
+}
+
+func classify(err error) outcome {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return OUTCOME_OPEN
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return OUTCOME_REFUSED
+	case errors.Is(err, syscall.ECONNRESET):
+		return OUTCOME_RESET
+	case errors.Is(err, syscall.ENETUNREACH),
+		errors.Is(err, syscall.EHOSTUNREACH),
+		errors.Is(err, syscall.ENOPROTOOPT):
+		return OUTCOME_UNREACHABLE
+	case errors.Is(err, syscall.ETIMEDOUT),
+		errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return OUTCOME_TIMEOUT
+	}
+	return OUTCOME_OTHER
+}
+
+// stats counts the outcomes of a scan, in total and for each /8. Looking at those tell a
+// quiet network apart from a broken uplink: the later shows up as a sudden jump of
+// timeouts or unreachable across every network
+type stats struct {
+	total    [outcomeCount]int64
+	networks [256][outcomeCount]int64
+}
+
+var STATS = &stats{}
+
+func (s *stats) add(ip net.IP, o outcome) {
+	atomic.AddInt64(&s.total[o], 1)
+	if v4 := ip.To4(); v4 != nil {
+		atomic.AddInt64(&s.networks[v4[0]][o], 1)
+	}
+}
+
+type statsJSON struct {
+	Outcomes map[string]int64            `json:"outcomes"`
+	Networks map[string]map[string]int64 `json:"networks"`
+}
+
+func (s *stats) MarshalJSON() ([]byte, error) {
+	out := statsJSON{
+		Outcomes: map[string]int64{},
+		Networks: map[string]map[string]int64{},
+	}
+	for o := outcome(0); o < outcomeCount; o++ {
+		out.Outcomes[o.String()] = atomic.LoadInt64(&s.total[o])
+	}
+	for n := range s.networks {
+		counts := map[string]int64{}
+		for o := outcome(0); o < outcomeCount; o++ {
+			if c := atomic.LoadInt64(&s.networks[n][o]); c > 0 {
+				counts[o.String()] = c
+			}
+		}
+		if len(counts) > 0 {
+			out.Networks[strconv.Itoa(n)+".0.0.0/8"] = counts
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON restores the counters of a run we're resuming
+func (s *stats) UnmarshalJSON(data []byte) error {
+	in := statsJSON{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	for o := outcome(0); o < outcomeCount; o++ {
+		atomic.StoreInt64(&s.total[o], in.Outcomes[o.String()])
+	}
+	for network, counts := range in.Networks {
+		n, err := strconv.Atoi(strings.TrimSuffix(network, ".0.0.0/8"))
+		if err != nil || n < 0 || n > 255 {
+			return fmt.Errorf("invalid network '%s' in stats", network)
+		}
+		for o := outcome(0); o < outcomeCount; o++ {
+			atomic.StoreInt64(&s.networks[n][o], counts[o.String()])
+		}
+	}
+	return nil
+}
+
+func (s *stats) String() string {
+	parts := []string{}
+	for o := outcome(0); o < outcomeCount; o++ {
+		parts = append(parts, fmt.Sprintf("%s=%d", o, atomic.LoadInt64(&s.total[o])))
+	}
+	return strings.Join(parts, " ")
+}
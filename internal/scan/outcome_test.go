@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if o := classify(err); o != OUTCOME_OPEN {
+		t.Errorf("open port classified as %s", o)
+	} else {
+		conn.Close()
+	}
+	l.Close()
+	if _, err = net.DialTimeout("tcp", addr, time.Second); classify(err) != OUTCOME_REFUSED {
+		t.Errorf("closed port classified as %s: %v", classify(err), err)
+	}
+
+	for _, tc := range []struct {
+		err  error
+		want outcome
+	}{
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNRESET)}, OUTCOME_RESET},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, OUTCOME_UNREACHABLE},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, OUTCOME_UNREACHABLE},
+		{&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, OUTCOME_TIMEOUT},
+		{errors.New("something else"), OUTCOME_OTHER},
+	} {
+		if got := classify(tc.err); got != tc.want {
+			t.Errorf("classify(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	s := &stats{}
+	s.add(net.ParseIP("8.8.8.8"), OUTCOME_OPEN)
+	s.add(net.ParseIP("8.8.4.4"), OUTCOME_TIMEOUT)
+	s.add(net.ParseIP("1.1.1.1"), OUTCOME_TIMEOUT)
+	s.add(net.ParseIP("2606:4700::1111"), OUTCOME_REFUSED)
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &stats{}
+	if err = json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.total != s.total || restored.networks != s.networks {
+		t.Errorf("stats changed after a round trip: %s", data)
+	}
+	if restored.networks[8][OUTCOME_TIMEOUT] != 1 || restored.total[OUTCOME_REFUSED] != 1 {
+		t.Errorf("unexpected counters: %s", data)
+	}
+}
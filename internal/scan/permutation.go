@@ -0,0 +1,158 @@
+package scan
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// permutation visits every index of [0, size) exactly once in a pseudorandom order. Like
+// zmap, it walks the multiplicative group of integers modulo a prime p > size: starting
+// from some element and repeatedly multiplying by a primitive root goes through every
+// value of [1, p-1] before coming back, values bigger than size are skipped.
+//
+// Sharding splits that cycle so shard i out of n only takes the elements at positions
+// i, i+n, i+2n, ... which gives disjoint subsets when every scanner uses the same seed.
+// Within a shard, the state of the walk is the position of the next element meaning a
+// scan can be resumed from that single integer.
+type permutation struct {
+	size   uint64
+	prime  uint64
+	first  uint64 // element at position 0 of the shard
+	step   uint64 // generator to the power of the number of shards
+	length uint64 // number of positions in the shard
+}
+
+func newPermutation(size uint64, seed int64, shard uint64, shards uint64) *permutation {
+	p := &permutation{size: size, prime: nextPrime(size)}
+	r := rand.New(rand.NewSource(seed))
+	gen := primitiveRoot(p.prime, r)
+	start := uint64(1)
+	if p.prime > 2 {
+		start = 1 + uint64(r.Int63n(int64(p.prime-1)))
+	}
+	p.first = mulmod(start, powmod(gen, shard, p.prime), p.prime)
+	p.step = powmod(gen, shards, p.prime)
+	if p.prime-1 > shard {
+		p.length = (p.prime - 1 - shard + shards - 1) / shards
+	}
+	return p
+}
+
+// at gives the element found at a position of the shard
+func (p *permutation) at(position uint64) uint64 {
+	return mulmod(p.first, powmod(p.step, position, p.prime), p.prime)
+}
+
+// iterateRandomly sends in a pseudorandom order every address of the scope that belongs
+// to the shard, starting from the given position
+func iterateRandomly(queue chan target, scope ipSet, perm *permutation, position uint64) {
+	offsets := make([]uint64, len(scope))
+	var total uint64
+	for i, r := range scope {
+		offsets[i] = total
+		total += uint64(r.to) - uint64(r.from) + 1
+	}
+	if position >= perm.length {
+		return
+	}
+	x := perm.at(position)
+	for ; position < perm.length; position++ {
+		if position%65536 == 0 {
+			fmt.Printf("\n+>%d ", position)
+		}
+		if index := x - 1; index < perm.size {
+			i := sort.Search(len(offsets), func(i int) bool { return offsets[i] > index }) - 1
+			queue <- target{int2ip(scope[i].from + uint32(index-offsets[i])), position}
+		}
+		x = mulmod(x, perm.step, perm.prime)
+	}
+}
+
+// parseShard reads a shard written as "i/n", i going from 0 to n-1
+func parseShard(str string) (uint64, uint64, error) {
+	parts := strings.Split(str, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid shard '%s', expected i/n", str)
+	}
+	shard, err1 := strconv.ParseUint(parts[0], 10, 32)
+	shards, err2 := strconv.ParseUint(parts[1], 10, 32)
+	if err1 != nil || err2 != nil || shards == 0 || shard >= shards {
+		return 0, 0, fmt.Errorf("invalid shard '%s', expected i/n with 0 <= i < n", str)
+	}
+	return shard, shards, nil
+}
+
+func nextPrime(n uint64) uint64 {
+	for n++; ; n++ {
+		if isPrime(n) {
+			return n
+		}
+	}
+}
+
+func isPrime(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for d := uint64(2); d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// primitiveRoot picks at random a generator of the multiplicative group modulo a prime.
+// g is a generator when g^((p-1)/q) != 1 for every prime factor q of p-1
+func primitiveRoot(prime uint64, r *rand.Rand) uint64 {
+	if prime <= 3 {
+		return prime - 1
+	}
+	factors := []uint64{}
+	n := prime - 1
+	for d := uint64(2); d*d <= n; d++ {
+		if n%d == 0 {
+			factors = append(factors, d)
+			for n%d == 0 {
+				n /= d
+			}
+		}
+	}
+	if n > 1 {
+		factors = append(factors, n)
+	}
+	for {
+		g := 2 + uint64(r.Int63n(int64(prime-3)))
+		ok := true
+		for _, q := range factors {
+			if powmod(g, (prime-1)/q, prime) == 1 {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return g
+		}
+	}
+}
+
+func mulmod(a uint64, b uint64, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, m)
+}
+
+func powmod(b uint64, e uint64, m uint64) uint64 {
+	result := uint64(1) % m
+	b %= m
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			result = mulmod(result, b, m)
+		}
+		b = mulmod(b, b, m)
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+package scan
+
+import (
+	"testing"
+)
+
+func TestPermutationShards(t *testing.T) {
+	scope := ipSet{{0x01020300, 0x010203ff}, {0x0a000000, 0x0a000fff}, {0xfffffffe, 0xffffffff}}
+	for _, shards := range []uint64{1, 3, 7} {
+		seen := map[string]int{}
+		for shard := uint64(0); shard < shards; shard++ {
+			queue := make(chan target, scope.Size())
+			iterateRandomly(queue, scope, newPermutation(scope.Size(), 42, shard, shards), 0)
+			close(queue)
+			for tg := range queue {
+				ip := tg.ip
+				if n, _ := ip2int(ip); !scope.Contains(n) {
+					t.Fatalf("%d shards: %s is out of scope", shards, ip)
+				}
+				seen[ip.String()]++
+			}
+		}
+		if uint64(len(seen)) != scope.Size() {
+			t.Fatalf("%d shards: visited %d addresses, want %d", shards, len(seen), scope.Size())
+		}
+		for ip, n := range seen {
+			if n != 1 {
+				t.Fatalf("%d shards: %s visited %d times", shards, ip, n)
+			}
+		}
+	}
+}
+
+func TestPermutationResume(t *testing.T) {
+	scope := ipSet{{0x0a000000, 0x0a0003ff}}
+	walk := func(perm *permutation, position uint64) []string {
+		queue := make(chan target, scope.Size())
+		iterateRandomly(queue, scope, perm, position)
+		close(queue)
+		out := []string{}
+		for tg := range queue {
+			out = append(out, tg.ip.String())
+		}
+		return out
+	}
+	perm := newPermutation(scope.Size(), 7, 1, 2)
+	full := walk(perm, 0)
+	resumed := walk(perm, perm.length/2)
+	if len(resumed) == 0 || len(resumed) >= len(full) {
+		t.Fatalf("resumed walk has %d addresses out of %d", len(resumed), len(full))
+	}
+	tail := full[len(full)-len(resumed):]
+	for i := range resumed {
+		if resumed[i] != tail[i] {
+			t.Fatalf("resumed walk differs at %d: %s != %s", i, resumed[i], tail[i])
+		}
+	}
+	if other := walk(newPermutation(scope.Size(), 8, 1, 2), 0); len(other) > 0 && other[0] == full[0] && other[1] == full[1] {
+		t.Errorf("different seeds gave the same order")
+	}
+}
+
+func TestParseShard(t *testing.T) {
+	if i, n, err := parseShard("2/5"); err != nil || i != 2 || n != 5 {
+		t.Errorf("parseShard(2/5) = %d, %d, %v", i, n, err)
+	}
+	for _, in := range []string{"5/5", "1/0", "1", "a/2", "-1/2"} {
+		if _, _, err := parseShard(in); err == nil {
+			t.Errorf("parseShard(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package scan
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+var CHECKPOINT_INTERVAL time.Duration = 30 * time.Second
+
+type runParams struct {
+	Targets     string        `json:"targets"`
+	Excludes    []string      `json:"excludes"`
+	Blocklist   string        `json:"blocklist"`
+	Order       string        `json:"order"`
+	Shard       string        `json:"shard"`
+	Concurrency int           `json:"concurrency"`
+	Ports       []int         `json:"ports"`
+	Hitlist     string        `json:"hitlist,omitempty"`
+	Banner      *bannerParams `json:"banner,omitempty"`
+	Explore     bool          `json:"explore,omitempty"`
+}
+
+type bannerParams struct {
+	Size    int           `json:"size"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+type scanRun struct {
+	id      int64
+	mu      sync.Mutex
+	pending []uint64
+	done    map[uint64]bool
+	cursor  uint64
+}
+
+func newScanRun(params runParams, seed int64, position uint64) (*scanRun, error) {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	rate, rate16, rate24 := LIMITER.Rates()
+	res, err := storage.DB.Exec(
+		"INSERT INTO scan_run(params, seed, position, rate, rate_16, rate_24) VALUES($1, $2, $3, $4, $5, $6)",
+		string(p), seed, position, rate, rate16, rate24,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &scanRun{id: id, done: map[uint64]bool{}, cursor: position}, nil
+}
+
+// resumeScanRun picks up the latest run that never reached its end
+func resumeScanRun() (*scanRun, runParams, int64, error) {
+	var (
+		id       int64
+		params   runParams
+		raw      string
+		seed     int64
+		position uint64
+		counts   sql.NullString
+	)
+	err := storage.DB.QueryRow(
+		"SELECT id, params, seed, position, stats FROM scan_run WHERE ended_at IS NULL ORDER BY id DESC LIMIT 1",
+	).Scan(&id, &raw, &seed, &position, &counts)
+	if err == sql.ErrNoRows {
+		return nil, params, 0, fmt.Errorf("no unfinished scan to resume")
+	} else if err != nil {
+		return nil, params, 0, err
+	} else if err = json.Unmarshal([]byte(raw), &params); err != nil {
+		return nil, params, 0, err
+	} else if counts.Valid {
+		if err = json.Unmarshal([]byte(counts.String), STATS); err != nil {
+			return nil, params, 0, err
+		}
+	}
+	if params.Targets == "-" || params.Hitlist == "-" {
+		return nil, params, 0, fmt.Errorf("scan #%d read its targets from stdin and can't be resumed", id)
+	}
+	for _, e := range params.Excludes {
+		if e == "-" {
+			return nil, params, 0, fmt.Errorf("scan #%d read its exclusions from stdin and can't be resumed", id)
+		}
+	}
+	return &scanRun{id: id, done: map[uint64]bool{}, cursor: position}, params, seed, nil
+}
+
+// enqueue is called right before a target is put on the queue, positions come in
+// increasing order
+func (r *scanRun) enqueue(position uint64) {
+	r.mu.Lock()
+	r.pending = append(r.pending, position)
+	r.cursor = position + 1
+	r.mu.Unlock()
+}
+
+// complete is called once a target has been dialed
+func (r *scanRun) complete(position uint64) {
+	r.mu.Lock()
+	r.done[position] = true
+	for len(r.pending) > 0 && r.done[r.pending[0]] {
+		delete(r.done, r.pending[0])
+		r.pending = r.pending[1:]
+	}
+	r.mu.Unlock()
+}
+
+// checkpoint gives the position everything before which has been dialed
+func (r *scanRun) checkpoint() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		return r.pending[0]
+	}
+	return r.cursor
+}
+
+// save records the checkpoint once the hosts found before it are committed, a crash
+// can't leave us with a position past results that never made it to the database
+func (r *scanRun) save(ended bool) error {
+	position := r.checkpoint()
+	if WRITER != nil {
+		if err := WRITER.Flush(); err != nil {
+			return err
+		}
+	}
+	counts, err := json.Marshal(STATS)
+	if err != nil {
+		return err
+	}
+	if ended {
+		_, err = storage.DB.Exec(
+			"UPDATE scan_run SET position = $1, stats = $2, updated_at = CURRENT_TIMESTAMP, ended_at = CURRENT_TIMESTAMP WHERE id = $3",
+			position, string(counts), r.id,
+		)
+		return err
+	}
+	_, err = storage.DB.Exec(
+		"UPDATE scan_run SET position = $1, stats = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+		position, string(counts), r.id,
+	)
+	return err
+}
+
+func (r *scanRun) rates() (float64, float64, float64, error) {
+	var rate, rate16, rate24 float64
+	err := storage.DB.QueryRow(
+		"SELECT rate, rate_16, rate_24 FROM scan_run WHERE id = $1", r.id,
+	).Scan(&rate, &rate16, &rate24)
+	return rate, rate16, rate24, err
+}
+
+// watchRates applies the rates changed with: ftpscan rate
+func (r *scanRun) watchRates() {
+	for range time.Tick(5 * time.Second) {
+		rate, rate16, rate24, err := r.rates()
+		if err != nil {
+			continue
+		}
+		r1, r2, r3 := LIMITER.Rates()
+		if rate == r1 && rate16 == r2 && rate24 == r3 {
+			continue
+		}
+		LIMITER.SetRates(rate, rate16, rate24)
+		fmt.Printf("\n[rate::%s, %s per /16, %s per /24]\n", formatRate(rate), formatRate(rate16), formatRate(rate24))
+	}
+}
+
+func (r *scanRun) autosave() {
+	for range time.Tick(CHECKPOINT_INTERVAL) {
+		if err := r.save(false); err != nil {
+			fmt.Printf("\n[checkpoint::error %s]\n", err.Error())
+		}
+	}
+}
+
+// in the reversed order, the position of an address is its byte reversed value
+func reversedPosition(ip uint32) uint64 {
+	return uint64(bits.ReverseBytes32(ip))
+}
@@ -0,0 +1,435 @@
+package scan
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+	"github.com/mickael-kerjean/ftpscan/internal/explore"
+	"github.com/mickael-kerjean/ftpscan/internal/shutdown"
+	"github.com/mickael-kerjean/ftpscan/internal/storage"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	CURRENT_IP   net.IP        = net.IPv4(0, 0, 0, 0)
+	CONCURRENCY  int           = 0
+	CHANSIZE     int           = 30000
+	DIAL_TIMEOUT time.Duration = 15 * time.Second
+	TARGETS      string        = ""
+	ORDER        string        = "reversed"
+	SEED         int64         = 0
+	SHARD        string        = "0/1"
+	POSITION     uint64        = 0
+	RESUME       bool          = false
+	PORTS        []int         = []int{21}
+	HITLIST      string        = ""
+	EXPLORE      bool          = false
+	EXCLUDES     fileList
+	WRITER       *storage.Writer
+
+	SHUTDOWN_TIMEOUT time.Duration = 30 * time.Second
+)
+
+type fileList []string
+
+func (f *fileList) String() string     { return strings.Join(*f, ",") }
+func (f *fileList) Set(s string) error { *f = append(*f, s); return nil }
+
+// Cmd is the scan phase: find the hosts that listen on the ports we care about
+func Cmd(args []string) {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	fs.StringVar(&TARGETS, "targets", TARGETS, "file of networks to scan, '-' to read from stdin")
+	fs.Var(&EXCLUDES, "exclude", "file of networks to skip, can be repeated")
+	fs.StringVar(&BLOCKLIST_FILE, "blocklist", BLOCKLIST_FILE, "file of networks to never dial, reloaded on SIGHUP")
+	fs.StringVar(&HITLIST, "hitlist", HITLIST, "file of ipv6 addresses or prefixes to scan instead of targets, '-' for stdin")
+	fs.StringVar(&ORDER, "order", ORDER, "order in which addresses are visited: 'reversed' or 'random'")
+	fs.Int64Var(&SEED, "seed", SEED, "seed of the random order, picked at random when 0")
+	fs.StringVar(&SHARD, "shard", SHARD, "part of the random order to scan, as i/n with 0 <= i < n")
+	fs.Uint64Var(&POSITION, "position", POSITION, "position to resume the random order from")
+	ports := fs.String("ports", formatPorts(PORTS), "comma separated list of ports to probe, eg: 21,990,2121,8021")
+	fs.BoolVar(&BANNER, "banner", BANNER, "read the greeting of open ports and store it along the host")
+	fs.IntVar(&BANNER_SIZE, "banner-size", BANNER_SIZE, "maximum number of bytes read from a greeting")
+	fs.DurationVar(&BANNER_TIMEOUT, "banner-timeout", BANNER_TIMEOUT, "maximum time spent waiting for a greeting")
+	fs.Float64Var(&RATE, "rate", RATE, "connection attempts per second, 0 for unlimited")
+	fs.Float64Var(&RATE_16, "rate16", RATE_16, "connection attempts per second for each /16, 0 for unlimited")
+	fs.Float64Var(&RATE_24, "rate24", RATE_24, "connection attempts per second for each /24, 0 for unlimited")
+	fs.DurationVar(&SHUTDOWN_TIMEOUT, "shutdown-timeout", SHUTDOWN_TIMEOUT, "time given to the dials in flight when stopping")
+	fs.BoolVar(&EXPLORE, "explore", EXPLORE, "hand the open ports over to the explore phase as soon as they're found")
+	fs.BoolVar(&RESUME, "resume", RESUME, "resume the latest unfinished scan with its original settings")
+	fs.Usage = func() {
+		fmt.Printf(`
+Usage: ftpscan scan [-targets file] [-exclude file]... [-blocklist file] [-ports list] [-banner] [-explore]
+                    [-rate n] [-rate16 n] [-rate24 n] concurrency [start ip]
+       ftpscan scan -order random [-seed n] [-shard i/n] [-position n] [-targets file] ... concurrency
+       ftpscan scan -hitlist file [-shard i/n] [-position n] [-blocklist file] ... concurrency
+       ftpscan scan -resume [concurrency]
+
+The concurrency can be left out when it's set in the config file. The start ip is a
+position in the walk over the entire internet, not an index in the targets: with -targets,
+the scan resumes from the first target that comes after it in that order. Only one of
+-targets and -exclude can be '-' to read from stdin.
+
+The random order is a permutation of the targets seeded by -seed. Scanners sharing the
+same seed and targets but with a different -shard cover disjoint parts of it. Progress
+is reported as a position that -position resumes from.
+
+A hitlist has an ipv6 address or prefix on each line, prefixes are expanded to all their
+addresses and can't be larger than a /112. Addresses are scanned in the order of the file
+and their position is their index in the expanded hitlist.
+
+Every scan is recorded in the scan_run table with a checkpoint saved every 30 seconds and
+on exit. -resume carries on the latest unfinished scan from its last checkpoint. On
+SIGINT or SIGTERM the dials in flight get -shutdown-timeout to finish before the
+checkpoint is saved, a second signal exits right away.
+
+Reserved networks (RFC 6890) are never scanned. The blocklist is checked before each
+dial and is reloaded without interrupting the scan with: kill -HUP <pid>
+
+With -banner the greeting of every open port is read, up to -banner-size bytes or for at
+most -banner-timeout, and saved in host.banner so non ftp services can be told apart
+without connecting again.
+
+With -explore the open ports are probed by the explore phase as soon as they're found,
+with the settings of its [explore] section. When its queue is full the scan waits for it
+to catch up. Ports with a greeting that isn't ftp are left out. Hosts still queued when
+the scan stops get explored by a later: ftpscan explore
+
+Rates are connection attempts per second, for the whole scan and for each /16 and /24.
+They can be changed while a scan is running with: ftpscan rate
+
+Usage: ftpscan rate [-id n] [-per16 rate] [-per24 rate] [global rate]
+       ftpscan optout add [-date YYYY-MM-DD] network requester [reason]
+       ftpscan optout list
+       ftpscan optout export
+`)
+	}
+	// -exclude replaces the exclusions of the config file instead of adding up
+	configured := EXCLUDES
+	EXCLUDES = nil
+	fs.Parse(args)
+	if EXCLUDES == nil {
+		EXCLUDES = configured
+	}
+	if err := storage.Open(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	if p, err := parsePorts(*ports); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	} else {
+		PORTS = p
+	}
+	var run *scanRun
+	if RESUME {
+		r, params, seed, err := resumeScanRun()
+		if err != nil {
+			fmt.Printf("ERROR %s\n", err.Error())
+			return
+		}
+		run = r
+		TARGETS, EXCLUDES, BLOCKLIST_FILE, HITLIST = params.Targets, params.Excludes, params.Blocklist, params.Hitlist
+		ORDER, SHARD, CONCURRENCY, SEED = params.Order, params.Shard, params.Concurrency, seed
+		if len(params.Ports) > 0 {
+			PORTS = params.Ports
+		}
+		EXPLORE = params.Explore
+		if params.Banner != nil {
+			BANNER, BANNER_SIZE, BANNER_TIMEOUT = true, params.Banner.Size, params.Banner.Timeout
+		}
+		POSITION = run.checkpoint()
+		rate, rate16, rate24, err := run.rates()
+		if err != nil {
+			fmt.Printf("ERROR %s\n", err.Error())
+			return
+		}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "rate":
+				rate = RATE
+			case "rate16":
+				rate16 = RATE_16
+			case "rate24":
+				rate24 = RATE_24
+			}
+		})
+		RATE, RATE_16, RATE_24 = rate, rate16, rate24
+		if ORDER == "reversed" {
+			if POSITION > 0xffffffff {
+				fmt.Printf("> scan #%d already went through every address\n", run.id)
+				run.save(true)
+				return
+			}
+			CURRENT_IP = int2ip(uint32(reversedPosition(uint32(POSITION))))
+			POSITION = 0
+		}
+		fmt.Printf("> resuming scan #%d\n", run.id)
+	}
+	if n, err := strconv.Atoi(fs.Arg(0)); err == nil {
+		CONCURRENCY = n
+	}
+	if CONCURRENCY < 1 {
+		fs.Usage()
+		return
+	} else if err := Settings().Validate(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	} else if err := setupBlocklist(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	if fs.NArg() > 1 && !RESUME {
+		if CURRENT_IP = net.ParseIP(fs.Arg(1)).To4(); CURRENT_IP == nil {
+			fmt.Printf("ERROR invalid start ip '%s'\n", fs.Arg(1))
+			return
+		}
+	}
+	if HITLIST != "" {
+		if TARGETS != "" || len(EXCLUDES) > 0 || (ORDER != "reversed" && ORDER != "hitlist") {
+			fmt.Printf("ERROR -hitlist can't be combined with -targets, -exclude or -order\n")
+			return
+		}
+		ORDER = "hitlist"
+	}
+	scope, err := getScope()
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	shard, shards, err := parseShard(SHARD)
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	} else if ORDER == "reversed" && (shards != 1 || POSITION != 0) {
+		fmt.Printf("ERROR -shard and -position require -order random or -hitlist\n")
+		return
+	}
+	if SEED == 0 {
+		SEED = time.Now().UnixNano()
+	}
+	config.Print("scan", Settings())
+	if EXPLORE {
+		config.Print("explore", explore.Settings())
+	}
+	if ORDER == "random" {
+		fmt.Printf("> order: random, seed %d, shard %d/%d, position %d\n", SEED, shard, shards, POSITION)
+	} else if ORDER == "hitlist" {
+		fmt.Printf("> hitlist: %s, shard %d/%d, position %d\n", HITLIST, shard, shards, POSITION)
+	} else {
+		fmt.Printf("> start ip: %s\n", CURRENT_IP.String())
+	}
+	if ORDER != "hitlist" {
+		fmt.Printf("> scope: %d addresses\n", scope.Size())
+	}
+	LIMITER.SetRates(RATE, RATE_16, RATE_24)
+	if run == nil {
+		var banner *bannerParams
+		if BANNER {
+			banner = &bannerParams{BANNER_SIZE, BANNER_TIMEOUT}
+		}
+		position := POSITION
+		if ORDER == "reversed" {
+			start, _ := ip2int(CURRENT_IP)
+			position = reversedPosition(start)
+		}
+		if run, err = newScanRun(runParams{
+			Targets:     TARGETS,
+			Excludes:    EXCLUDES,
+			Blocklist:   BLOCKLIST_FILE,
+			Order:       ORDER,
+			Shard:       SHARD,
+			Concurrency: CONCURRENCY,
+			Ports:       PORTS,
+			Hitlist:     HITLIST,
+			Banner:      banner,
+			Explore:     EXPLORE,
+		}, SEED, position); err != nil {
+			fmt.Printf("ERROR %s\n", err.Error())
+			return
+		}
+		fmt.Printf("> scan #%d\n", run.id)
+	}
+	if _, err = storage.DB.Exec(
+		"UPDATE scan_run SET rate = $1, rate_16 = $2, rate_24 = $3 WHERE id = $4",
+		RATE, RATE_16, RATE_24, run.id,
+	); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+		return
+	}
+	// the explore phase shares our writer: the details of a host are written after it
+	WRITER = storage.NewWriter()
+	if EXPLORE {
+		if err := explore.Start(WRITER); err != nil {
+			fmt.Printf("ERROR %s\n", err.Error())
+			return
+		}
+	}
+	go run.autosave()
+	go run.watchRates()
+	shutdown.Handle()
+
+	queue := make(chan target, CHANSIZE)
+	var wg sync.WaitGroup
+	for i := 0; i < CONCURRENCY; i++ {
+		wg.Add(1)
+		go func() {
+			for t := range queue {
+				// what's left in the queue stays pending and is dialed on resume
+				if shutdown.Stopped() {
+					continue
+				}
+				// a target whose ports weren't all dialed stays pending as well
+				if runner(t.ip) {
+					run.complete(t.position)
+				}
+			}
+			wg.Done()
+		}()
+	}
+	targets := make(chan target)
+	go func() {
+		if ORDER == "random" {
+			iterateRandomly(targets, scope, newPermutation(scope.Size(), SEED, shard, shards), POSITION)
+		} else if ORDER == "hitlist" {
+			if err := scanHitlist(targets, HITLIST, shard, shards); err != nil {
+				fmt.Printf("\nERROR %s\n", err.Error())
+			}
+		} else {
+			iterateThroughPublicIPs(targets, scope)
+		}
+		close(targets)
+	}()
+produce:
+	for t := range targets {
+		run.enqueue(t.position)
+		select {
+		case queue <- t:
+		case <-shutdown.STOP:
+			break produce
+		}
+	}
+	fmt.Printf("\n")
+	close(queue)
+	finished := shutdown.Wait(&wg, SHUTDOWN_TIMEOUT)
+	if !finished {
+		fmt.Printf("> gave up on the dials still running after %s\n", SHUTDOWN_TIMEOUT)
+	}
+	if EXPLORE {
+		explore.Wait()
+	}
+	// the run only ends once every target was dialed
+	interrupted := shutdown.Stopped() || !finished
+	if err := run.save(!interrupted); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+	}
+	if err := WRITER.Close(); err != nil {
+		fmt.Printf("ERROR %s\n", err.Error())
+	}
+	storage.DB.Close()
+	fmt.Printf("> outcomes: %s\n", STATS.String())
+	fmt.Printf("> writes: %s\n", WRITER.String())
+	if interrupted {
+		fmt.Printf("> scan #%d stopped at position %d, continue with: ftpscan scan -resume\n", run.id, run.checkpoint())
+		os.Exit(1)
+	}
+}
+
+func formatPorts(ports []int) string {
+	list := []string{}
+	for _, port := range ports {
+		list = append(list, strconv.Itoa(port))
+	}
+	return strings.Join(list, ",")
+}
+
+// parsePorts reads a comma separated list of ports
+func parsePorts(str string) ([]int, error) {
+	ports := []int{}
+	for _, p := range strings.Split(str, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port '%s'", p)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func getScope() (ipSet, error) {
+	stdin := 0
+	for _, path := range append([]string{TARGETS, HITLIST}, EXCLUDES...) {
+		if path == "-" {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		return nil, fmt.Errorf("stdin can only be used once across -targets, -hitlist and -exclude")
+	}
+	scope := ipSet{{0, 0xffffffff}}.Subtract(RESERVED)
+	if TARGETS != "" {
+		targets, err := loadIPSet(TARGETS)
+		if err != nil {
+			return nil, err
+		}
+		scope = targets.Subtract(RESERVED)
+	}
+	if len(EXCLUDES) > 0 {
+		excludes, err := loadIPSet(EXCLUDES...)
+		if err != nil {
+			return nil, err
+		}
+		scope = scope.Subtract(excludes)
+	}
+	return scope, nil
+}
+
+// runner dials the ports of ip, it tells if it went through all of them before we were
+// asked to stop
+func runner(ip net.IP) bool {
+	if isBlocked(ip) {
+		return true
+	}
+	for _, port := range PORTS {
+		if shutdown.Stopped() {
+			return false
+		}
+		LIMITER.Wait(ip)
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)), DIAL_TIMEOUT)
+		o := classify(err)
+		STATS.add(ip, o)
+		if o == OUTCOME_OTHER {
+			fmt.Printf("ERR[%+v]", err)
+		}
+		if err != nil {
+			continue
+		}
+		banner := ""
+		if BANNER {
+			banner = readBanner(conn)
+		}
+		conn.Close()
+		insertDB(ip, port, banner, start)
+	}
+	return true
+}
+
+// HOST_UPSERT keeps the banner we already have when a scan runs without -banner
+const HOST_UPSERT = `INSERT INTO host(ip, port, banner) VALUES($1, $2, $3)
+  ON CONFLICT(ip, port) DO UPDATE SET banner = COALESCE(excluded.banner, host.banner)`
+
+func insertDB(ip net.IP, port int, banner string, start time.Time) {
+	WRITER.Write(HOST_UPSERT, ip.String(), port, sql.NullString{String: banner, Valid: BANNER})
+	WRITER.Observe(ip.String(), port, "scan", storage.OUTCOME_OPEN, start, banner)
+	if EXPLORE && (banner == "" || looksLikeFTP(banner)) {
+		explore.Push(ip, port)
+	}
+	storage.Emit("scan", map[string]interface{}{"ip": ip.String(), "port": port, "banner": banner})
+	fmt.Printf("[%s]", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+}
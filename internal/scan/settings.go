@@ -0,0 +1,40 @@
+package scan
+
+import (
+	"github.com/mickael-kerjean/ftpscan/internal/config"
+)
+
+// Settings gives the current settings of the scan
+func Settings() config.Scan {
+	return config.Scan{
+		Targets:         TARGETS,
+		Exclude:         EXCLUDES,
+		Blocklist:       BLOCKLIST_FILE,
+		Hitlist:         HITLIST,
+		Explore:         EXPLORE,
+		Order:           ORDER,
+		Seed:            SEED,
+		Shard:           SHARD,
+		Ports:           PORTS,
+		Concurrency:     CONCURRENCY,
+		QueueSize:       CHANSIZE,
+		DialTimeout:     config.Duration{Duration: DIAL_TIMEOUT},
+		Banner:          BANNER,
+		BannerSize:      BANNER_SIZE,
+		BannerTimeout:   config.Duration{Duration: BANNER_TIMEOUT},
+		Rate:            RATE,
+		Rate16:          RATE_16,
+		Rate24:          RATE_24,
+		ShutdownTimeout: config.Duration{Duration: SHUTDOWN_TIMEOUT},
+	}
+}
+
+// Configure applies the settings of the config file, the flags have the last word
+func Configure(c config.Scan) {
+	TARGETS, EXCLUDES, BLOCKLIST_FILE, HITLIST = c.Targets, c.Exclude, c.Blocklist, c.Hitlist
+	ORDER, SEED, SHARD, PORTS, EXPLORE = c.Order, c.Seed, c.Shard, c.Ports, c.Explore
+	CONCURRENCY, CHANSIZE, DIAL_TIMEOUT = c.Concurrency, c.QueueSize, c.DialTimeout.Duration
+	BANNER, BANNER_SIZE, BANNER_TIMEOUT = c.Banner, c.BannerSize, c.BannerTimeout.Duration
+	RATE, RATE_16, RATE_24 = c.Rate, c.Rate16, c.Rate24
+	SHUTDOWN_TIMEOUT = c.ShutdownTimeout.Duration
+}
@@ -0,0 +1,115 @@
+package scan
+
+import (
+	"container/heap"
+	"fmt"
+	"math/bits"
+	"net"
+)
+
+// to avoid being to hard on networks, we're traversing to the public internet like this:
+// 0.0.0.0
+// 1.0.0.0
+// 2.0.0.0
+// ...
+// 255.0.0.0
+// 0.1.0.0
+// 1.1.0.0
+// 2.1.0.0
+// ...
+// In other words, addresses are visited in the order of their byte reversed value, we call
+// that value the "key". When the scope is restricted to a list of networks, each network is
+// walked in key order and all those walks get merged together so the ordering stays the same
+// as if we were walking the entire internet and skipping whatever is out of scope.
+func iterateThroughPublicIPs(queue chan target, scope ipSet) {
+	start, _ := ip2int(CURRENT_IP)
+	walks := &keyWalks{}
+	for _, n := range scope.cidrs() {
+		base, _ := ip2int(n.IP)
+		ones, _ := n.Mask.Size()
+		w := &keyWalk{
+			fixed: bits.ReverseBytes32(base),
+			free:  bits.ReverseBytes32(uint32(uint64(1)<<uint(32-ones) - 1)),
+		}
+		if w.seek(bits.ReverseBytes32(start)) {
+			*walks = append(*walks, w)
+		}
+	}
+	heap.Init(walks)
+
+	progress := int64(-1)
+	for walks.Len() > 0 {
+		w := (*walks)[0]
+		if int64(w.key>>16) != progress {
+			progress = int64(w.key >> 16)
+			fmt.Printf("\n+>x.x.%d.%d ", byte(w.key>>16), byte(w.key>>24))
+		}
+		queue <- target{int2ip(bits.ReverseBytes32(w.key)), uint64(w.key)}
+		if w.next() {
+			heap.Fix(walks, 0)
+		} else {
+			heap.Pop(walks)
+		}
+	}
+}
+
+// target is an address to dial along with its position in the scan order
+type target struct {
+	ip       net.IP
+	position uint64
+}
+
+// keyWalk enumerates in increasing order the keys of a network, that is all the values
+// made of the fixed bits and any combination of the free bits
+type keyWalk struct {
+	fixed uint32
+	free  uint32
+	key   uint32
+}
+
+// seek positions the walk on the smallest key greater or equal to k
+func (w *keyWalk) seek(k uint32) bool {
+	if w.fixed|w.free < k {
+		return false
+	}
+	v := w.fixed | (k & w.free)
+	diff := v ^ k
+	if diff == 0 {
+		w.key = v
+		return true
+	}
+	d := uint32(1) << uint(31-bits.LeadingZeros32(diff))
+	below := d - 1
+	if v&d != 0 {
+		w.key = v &^ (below & w.free)
+		return true
+	}
+	candidates := w.free &^ v &^ (d | below)
+	if candidates == 0 {
+		return false
+	}
+	p := candidates & -candidates
+	w.key = (v | p) &^ ((p - 1) & w.free)
+	return true
+}
+
+func (w *keyWalk) next() bool {
+	if w.key&w.free == w.free {
+		return false
+	}
+	w.key = w.fixed | (((w.key | ^w.free) + 1) & w.free)
+	return true
+}
+
+type keyWalks []*keyWalk
+
+func (h keyWalks) Len() int            { return len(h) }
+func (h keyWalks) Less(i, j int) bool  { return h[i].key < h[j].key }
+func (h keyWalks) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyWalks) Push(x interface{}) { *h = append(*h, x.(*keyWalk)) }
+func (h *keyWalks) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,58 @@
+package shutdown
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// STOP is closed once we're asked to stop, phases stop feeding work to their workers
+var STOP = make(chan struct{})
+
+// Handle closes STOP on the first SIGINT or SIGTERM so we can wind down cleanly,
+// a second one exits right away
+func Handle() {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		fmt.Printf("\n> stopping, signal again to force it\n")
+		close(STOP)
+		<-sig
+		fmt.Printf("\n> forced to stop\n")
+		os.Exit(2)
+	}()
+}
+
+func Stopped() bool {
+	select {
+	case <-STOP:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits on the workers to be done with their work. Once we're asked to stop they're
+// given at most timeout and are left behind if they're not done by then
+func Wait(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-STOP:
+	}
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// TIMESTAMP is the format of CURRENT_TIMESTAMP, times we write ourselves use it so they
+// compare with the ones sqlite wrote
+const TIMESTAMP = "2006-01-02 15:04:05"
+
+// outcomes of an observation, anything but OUTCOME_UNREACHABLE means the host was seen
+const (
+	OUTCOME_OPEN        = "open"
+	OUTCOME_UNREACHABLE = "unreachable"
+	OUTCOME_UNAVAILABLE = "unavailable"
+	OUTCOME_AVAILABLE   = "available"
+	OUTCOME_ANONYMOUS   = "anonymous"
+)
+
+const OBSERVATION_INSERT = `INSERT INTO observation(related_ip, related_port, phase, timestamp, outcome, duration, summary)
+  VALUES($1, $2, $3, $4, $5, $6, $7)`
+
+// Observe keeps track of what a phase made of a host from start till now. The host gets
+// its first_seen, last_seen and last_status updated along by the observation_host trigger
+func (w *Writer) Observe(ip string, port int, phase string, outcome string, start time.Time, summary string) {
+	if len(summary) > 200 {
+		summary = strings.ToValidUTF8(summary[:200], "")
+	}
+	w.Write(
+		OBSERVATION_INSERT, ip, port, phase, start.UTC().Format(TIMESTAMP), outcome,
+		time.Since(start).Seconds(), sql.NullString{String: summary, Valid: summary != ""},
+	)
+}
+
+// addHistory brings the columns summing up observations to the hosts found before we kept
+// track of them, the time they were found is all we know. A step only runs when its first
+// column is missing
+func addHistory() error {
+	for _, step := range [][]string{
+		{
+			"ALTER TABLE host ADD COLUMN first_seen TIMESTAMP",
+			"ALTER TABLE host ADD COLUMN last_seen TIMESTAMP",
+			"ALTER TABLE host ADD COLUMN last_status TEXT",
+			"UPDATE host SET first_seen = timestamp, last_seen = timestamp",
+			`UPDATE host SET last_status = (
+  SELECT CASE WHEN details.anonymous THEN 'anonymous' WHEN details.available THEN 'available' ELSE 'unavailable' END
+  FROM details WHERE details.related_ip = host.ip AND details.related_port = host.port
+)`,
+			"UPDATE host SET last_status = 'open' WHERE last_status IS NULL",
+		},
+		{
+			"ALTER TABLE host ADD COLUMN checked_at TIMESTAMP",
+			"ALTER TABLE host ADD COLUMN failures INTEGER NOT NULL DEFAULT 0",
+			"UPDATE host SET checked_at = COALESCE(last_seen, timestamp)",
+		},
+	} {
+		if _, err := DB.Exec(step[0]); err != nil {
+			continue
+		}
+		for _, query := range step[1:] {
+			if _, err := DB.Exec(query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
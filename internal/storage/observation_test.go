@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+	db, err := sql.Open(DRIVER, filepath.Join(t.TempDir(), "ftp.sqlite")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old *sql.DB) { DB = old }(DB)
+	DB = db
+	defer db.Close()
+	// a host found before we kept track of its history
+	if _, err = DB.Exec("CREATE TABLE host (ip VARCHAR(45) NOT NULL, port INTEGER NOT NULL DEFAULT 21, timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP, banner TEXT, PRIMARY KEY (ip, port))"); err != nil {
+		t.Fatal(err)
+	} else if _, err = DB.Exec("INSERT INTO host(ip, port, timestamp) VALUES('8.8.8.8', 21, '2020-01-01 00:00:00')"); err != nil {
+		t.Fatal(err)
+	} else if err = migrate(); err != nil {
+		t.Fatal(err)
+	}
+	host := func(ip string) (first, last, status string) {
+		DB.QueryRow("SELECT COALESCE(first_seen, ''), COALESCE(last_seen, ''), COALESCE(last_status, '') FROM host WHERE ip = $1", ip).Scan(&first, &last, &status)
+		return first, last, status
+	}
+	if first, last, status := host("8.8.8.8"); first != "2020-01-01 00:00:00" || last != first || status != OUTCOME_OPEN {
+		t.Errorf("history of an older host: %s %s %s", first, last, status)
+	}
+
+	w := NewWriter()
+	day := func(d int) time.Time { return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC) }
+	w.Write("INSERT INTO host(ip, port) VALUES($1, $2)", "8.8.4.4", 21)
+	w.Observe("8.8.4.4", 21, "scan", OUTCOME_OPEN, day(1), "220 hello")
+	w.Observe("8.8.4.4", 21, "explore", OUTCOME_ANONYMOUS, day(2), "vsftpd 3.0.3")
+	w.Observe("8.8.4.4", 21, "explore", OUTCOME_UNREACHABLE, day(3), "connection refused")
+	w.Observe("8.8.8.8", 21, "explore", OUTCOME_AVAILABLE, day(4), "")
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if first, last, status := host("8.8.4.4"); first != "2021-01-01 00:00:00" || last != "2021-01-02 00:00:00" || status != OUTCOME_UNREACHABLE {
+		t.Errorf("history of 8.8.4.4: %s %s %s", first, last, status)
+	}
+	if first, last, status := host("8.8.8.8"); first != "2020-01-01 00:00:00" || last != "2021-01-04 00:00:00" || status != OUTCOME_AVAILABLE {
+		t.Errorf("history of 8.8.8.8: %s %s %s", first, last, status)
+	}
+	checked, failures := "", 0
+	DB.QueryRow("SELECT COALESCE(checked_at, ''), failures FROM host WHERE ip = '8.8.4.4'").Scan(&checked, &failures)
+	if checked != "2021-01-03 00:00:00" || failures != 1 {
+		t.Errorf("8.8.4.4 checked at %s with %d failures", checked, failures)
+	}
+	n := 0
+	DB.QueryRow("SELECT COUNT(*) FROM observation WHERE related_ip = '8.8.4.4' AND duration > 0").Scan(&n)
+	if n != 3 {
+		t.Errorf("%d observations of 8.8.4.4, want 3", n)
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	results   *os.File = nil
+	resultsMu sync.Mutex
+)
+
+// OpenResults appends every result to a json lines file on top of the database, so other
+// tools can follow along without querying sqlite
+func OpenResults(path string) (err error) {
+	results, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+// Emit appends a result of the given phase to the results file when there's one
+func Emit(phase string, fields map[string]interface{}) {
+	if results == nil {
+		return
+	}
+	fields["phase"] = phase
+	fields["time"] = time.Now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	resultsMu.Lock()
+	results.Write(append(line, '\n'))
+	resultsMu.Unlock()
+}
@@ -0,0 +1,137 @@
+package storage
+
+// hosts found listening by the scan
+const HOST_SCHEMA = `CREATE TABLE IF NOT EXISTS host (
+  ip VARCHAR(45) NOT NULL,
+  port INTEGER NOT NULL DEFAULT 21,
+  timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  banner TEXT,
+  PRIMARY KEY (ip, port)
+)`
+
+// what the explore phase learnt about a host
+const DETAILS_SCHEMA = `CREATE TABLE IF NOT EXISTS details (
+  related_ip TEXT,
+  related_port INTEGER NOT NULL DEFAULT 21,
+  available BOOL,
+  anonymous BOOL,
+  ftps BOOL,
+  stream TEXT,
+  FOREIGN KEY(related_ip, related_port) REFERENCES host(ip, port)
+)`
+
+// what a server says it supports in its reply to FEAT, one row per feature and for the
+// features that come with a list (AUTH, HASH, LANG, MLST) one row per item of the list
+const CAPABILITIES_SCHEMA = `CREATE TABLE IF NOT EXISTS capabilities (
+  related_ip TEXT NOT NULL,
+  related_port INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  value TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (related_ip, related_port, name, value),
+  FOREIGN KEY(related_ip, related_port) REFERENCES host(ip, port)
+)`
+
+// certificates presented by servers after AUTH TLS, many hosts share the same ones
+const CERTIFICATE_SCHEMA = `CREATE TABLE IF NOT EXISTS certificate (
+  fingerprint TEXT PRIMARY KEY,
+  subject TEXT NOT NULL,
+  issuer TEXT NOT NULL,
+  sans TEXT NOT NULL DEFAULT '',
+  not_before TIMESTAMP,
+  not_after TIMESTAMP,
+  key_type TEXT,
+  self_signed BOOL,
+  raw BLOB,
+  timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+// the chain presented by a host, position 0 being its own certificate
+const HOST_CERTIFICATE_SCHEMA = `CREATE TABLE IF NOT EXISTS host_certificate (
+  related_ip TEXT NOT NULL,
+  related_port INTEGER NOT NULL,
+  position INTEGER NOT NULL,
+  fingerprint TEXT NOT NULL REFERENCES certificate(fingerprint),
+  PRIMARY KEY (related_ip, related_port, position),
+  FOREIGN KEY(related_ip, related_port) REFERENCES host(ip, port)
+)`
+
+// entries of the anonymous servers crawled by the index phase, path being the directory
+// they're in. type is one of file, dir, link, other or unknown when the server only gave
+// us names, size and mtime are NULL when the listing doesn't tell. The id is what the
+// search index refers to, an implicit rowid could change with a VACUUM
+const FILE_SCHEMA = `CREATE TABLE IF NOT EXISTS file (
+  id INTEGER PRIMARY KEY,
+  related_ip TEXT NOT NULL,
+  related_port INTEGER NOT NULL,
+  path TEXT NOT NULL,
+  name TEXT NOT NULL,
+  type TEXT NOT NULL,
+  size INTEGER,
+  mtime TIMESTAMP,
+  permissions TEXT,
+  timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (related_ip, related_port, path, name),
+  FOREIGN KEY(related_ip, related_port) REFERENCES host(ip, port)
+)`
+
+// every time a phase looked at a host, rows are never updated. duration is in seconds
+const OBSERVATION_SCHEMA = `CREATE TABLE IF NOT EXISTS observation (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  related_ip TEXT NOT NULL,
+  related_port INTEGER NOT NULL,
+  phase TEXT NOT NULL,
+  timestamp TIMESTAMP NOT NULL,
+  outcome TEXT NOT NULL,
+  duration REAL,
+  summary TEXT,
+  FOREIGN KEY(related_ip, related_port) REFERENCES host(ip, port)
+)`
+
+const OBSERVATION_INDEX = `CREATE INDEX IF NOT EXISTS observation_host
+  ON observation(related_ip, related_port, timestamp)`
+
+// the host keeps the gist of its observations: when it was first and last seen answering,
+// when it was last checked, the outcome of that check and how many times in a row it
+// couldn't be reached
+const OBSERVATION_TRIGGER = `CREATE TRIGGER observation_host AFTER INSERT ON observation BEGIN
+  UPDATE host SET
+    first_seen = CASE WHEN NEW.outcome = 'unreachable' THEN first_seen ELSE COALESCE(first_seen, NEW.timestamp) END,
+    last_seen = CASE WHEN NEW.outcome = 'unreachable' THEN last_seen ELSE MAX(COALESCE(last_seen, ''), NEW.timestamp) END,
+    checked_at = MAX(COALESCE(checked_at, ''), NEW.timestamp),
+    last_status = NEW.outcome,
+    failures = CASE WHEN NEW.outcome = 'unreachable' THEN failures + 1 ELSE 0 END
+  WHERE ip = NEW.related_ip AND port = NEW.related_port;
+END`
+
+// HOST_DEPENDENTS are the tables referencing a host, their rows go away with the host
+var HOST_DEPENDENTS = []string{"details", "capabilities", "host_certificate", "observation", "file"}
+
+// the optout registry keeps track of every network whose owner asked us to stop scanning
+// them. Every phase reads it before dialing and everything we already know about those
+// networks gets purged when they are added
+const OPTOUT_SCHEMA = `CREATE TABLE IF NOT EXISTS optout (
+  network TEXT PRIMARY KEY,
+  ip_from INTEGER NOT NULL,
+  ip_to INTEGER NOT NULL,
+  requester TEXT NOT NULL,
+  reason TEXT,
+  requested_at DATE NOT NULL,
+  timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+// a scan run is persisted in the database so an interrupted scan can carry on where it
+// stopped. The position we save is the one of the first address that wasn't fully dialed
+// yet: on resume some addresses might get dialed twice but none can be missed
+const SCAN_RUN_SCHEMA = `CREATE TABLE IF NOT EXISTS scan_run (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  params TEXT NOT NULL,
+  seed INTEGER NOT NULL,
+  position INTEGER NOT NULL DEFAULT 0,
+  started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  ended_at TIMESTAMP,
+  rate REAL NOT NULL DEFAULT 0,
+  rate_16 REAL NOT NULL DEFAULT 0,
+  rate_24 REAL NOT NULL DEFAULT 0,
+  stats TEXT
+)`
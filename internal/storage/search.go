@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+	"unicode"
+)
+
+// DRIVER is sqlite with the functions the schema relies on, the triggers of the search
+// index call words
+const DRIVER = "sqlite3_ftpscan"
+
+func init() {
+	sql.Register(DRIVER, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("words", Words, true)
+		},
+	})
+}
+
+// Words splits a path or a file name into what people search for: the parts between
+// separators and the parts of camelCase and of names mixing letters and digits, the
+// whole word being kept as well. "/pub/DebianInstaller_12.iso" gives
+// "pub DebianInstaller Debian Installer 12 iso"
+func Words(str string) string {
+	words := []string{}
+	for _, word := range strings.FieldsFunc(str, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		parts := splitCase(word)
+		if len(parts) > 1 {
+			words = append(words, word)
+		}
+		words = append(words, parts...)
+	}
+	return strings.Join(words, " ")
+}
+
+// splitCase cuts a word where lower case turns to upper case, where an acronym ends
+// ("HTTPServer" gives HTTP and Server) and between letters and digits
+func splitCase(word string) []string {
+	runes := []rune(word)
+	parts := []string{}
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, r := runes[i-1], runes[i]
+		cut := unicode.IsLower(prev) && unicode.IsUpper(r) ||
+			unicode.IsDigit(prev) != unicode.IsDigit(r) ||
+			unicode.IsUpper(prev) && unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if cut {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
+
+// Match turns what's searched for into an fts5 query: every word has to be there, as a
+// word or the start of one
+func Match(terms string) string {
+	match := []string{}
+	for _, word := range strings.Fields(Words(terms)) {
+		match = append(match, `"`+word+`"*`)
+	}
+	return strings.Join(match, " ")
+}
@@ -0,0 +1,57 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package storage
+
+// SEARCH tells if the names of the file table can be searched, the index needs a build
+// with: go build -tags sqlite_fts5
+const SEARCH = true
+
+// the search index over the paths and names of the file table. It's contentless, the
+// words of an entry are only there to be matched and its rowid is the id of the entry
+const FILE_SEARCH_SCHEMA = `CREATE VIRTUAL TABLE IF NOT EXISTS file_search USING fts5(
+  path, name, content='', tokenize='unicode61 remove_diacritics 2'
+)`
+
+// a contentless index forgets an entry when given the words it was indexed with
+var FILE_SEARCH_TRIGGERS = []string{
+	`CREATE TRIGGER file_search_insert AFTER INSERT ON file BEGIN
+  INSERT INTO file_search(rowid, path, name) VALUES(NEW.id, words(NEW.path), words(NEW.name));
+END`,
+	`CREATE TRIGGER file_search_delete AFTER DELETE ON file BEGIN
+  INSERT INTO file_search(file_search, rowid, path, name) VALUES('delete', OLD.id, words(OLD.path), words(OLD.name));
+END`,
+	`CREATE TRIGGER file_search_update AFTER UPDATE OF path, name ON file BEGIN
+  INSERT INTO file_search(file_search, rowid, path, name) VALUES('delete', OLD.id, words(OLD.path), words(OLD.name));
+  INSERT INTO file_search(rowid, path, name) VALUES(NEW.id, words(NEW.path), words(NEW.name));
+END`,
+}
+
+// migrateSearch creates the search index along with the triggers keeping it in sync. The
+// index is built again when the triggers weren't there, the database being new or one a
+// build without the index wrote to
+func migrateSearch() error {
+	var exists int
+	DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'file_search_insert'").Scan(&exists)
+	if exists > 0 {
+		return nil
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	queries := []string{
+		"DROP TRIGGER IF EXISTS file_search_delete",
+		"DROP TRIGGER IF EXISTS file_search_update",
+		FILE_SEARCH_SCHEMA,
+		"INSERT INTO file_search(file_search) VALUES('delete-all')",
+		"INSERT INTO file_search(rowid, path, name) SELECT id, words(path), words(name) FROM file",
+	}
+	for _, query := range append(queries, FILE_SEARCH_TRIGGERS...) {
+		if _, err = tx.Exec(query); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
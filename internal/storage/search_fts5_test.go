@@ -0,0 +1,80 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	db, err := sql.Open(DRIVER, filepath.Join(t.TempDir(), "ftp.sqlite")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old *sql.DB) { DB = old }(DB)
+	DB = db
+	defer db.Close()
+	if err = migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		"INSERT INTO host(ip, port) VALUES('8.8.8.8', 21)",
+		"INSERT INTO file(related_ip, related_port, path, name, type) VALUES('8.8.8.8', 21, '/pub/debian', 'debian-12-amd64.iso', 'file')",
+		"INSERT INTO file(related_ip, related_port, path, name, type) VALUES('8.8.8.8', 21, '/pub/debian', 'README', 'file')",
+		"INSERT INTO file(related_ip, related_port, path, name, type) VALUES('8.8.8.8', 21, '/backup', 'DebianInstaller.iso', 'file')",
+		"INSERT INTO file(related_ip, related_port, path, name, type) VALUES('8.8.8.8', 21, '/backup', 'notes.txt', 'file')",
+	} {
+		if _, err = DB.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	search := func(terms string) []string {
+		rows, err := DB.Query(`SELECT file.name FROM file_search JOIN file ON file.id = file_search.rowid
+  WHERE file_search MATCH $1 ORDER BY bm25(file_search, 1.0, 4.0), file.id`, Match(terms))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		names := []string{}
+		for rows.Next() {
+			var name string
+			rows.Scan(&name)
+			names = append(names, name)
+		}
+		return names
+	}
+	// a match on the name comes before one on the path
+	if got := search("debian"); len(got) != 3 || got[2] != "README" {
+		t.Errorf("search debian = %q", got)
+	}
+	if got := search("install iso"); !reflect.DeepEqual(got, []string{"DebianInstaller.iso"}) {
+		t.Errorf("search install iso = %q", got)
+	}
+
+	// the triggers keep the index in sync
+	DB.Exec("DELETE FROM file WHERE name = 'DebianInstaller.iso'")
+	DB.Exec("UPDATE file SET name = 'todo.txt' WHERE name = 'notes.txt'")
+	if got := search("installer"); len(got) != 0 {
+		t.Errorf("search of a deleted entry = %q", got)
+	}
+	if got := search("notes"); len(got) != 0 {
+		t.Errorf("search of a renamed entry = %q", got)
+	} else if got = search("todo"); !reflect.DeepEqual(got, []string{"todo.txt"}) {
+		t.Errorf("search of the new name = %q", got)
+	}
+
+	// entries written by a build without the index are there once it's back
+	DB.Exec("DROP TRIGGER file_search_insert")
+	DB.Exec("INSERT INTO file(related_ip, related_port, path, name, type) VALUES('8.8.8.8', 21, '/', 'late.txt', 'file')")
+	if err = migrate(); err != nil {
+		t.Fatal(err)
+	} else if got := search("late"); !reflect.DeepEqual(got, []string{"late.txt"}) {
+		t.Errorf("search after the index is built again = %q", got)
+	} else if got = search("todo"); !reflect.DeepEqual(got, []string{"todo.txt"}) {
+		t.Errorf("search after the index is built again = %q", got)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !sqlite_fts5
+// +build !sqlite_fts5
+
+package storage
+
+const SEARCH = false
+
+// migrateSearch drops the triggers of the search index as they'd fail without fts5, a
+// build with it brings the index up to date again
+func migrateSearch() error {
+	for _, name := range []string{"file_search_insert", "file_search_delete", "file_search_update"} {
+		if _, err := DB.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
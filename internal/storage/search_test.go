@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	for str, want := range map[string]string{
+		"/pub/DebianInstaller_12.iso":   "pub DebianInstaller Debian Installer 12 iso",
+		"my-holiday.photos_2019.JPG":    "my holiday photos 2019 JPG",
+		"HTTPServerLogs.tar.gz":         "HTTPServerLogs HTTP Server Logs tar gz",
+		"ubuntu22.04-desktop-amd64.iso": "ubuntu22 ubuntu 22 04 desktop amd64 amd 64 iso",
+		"Überweisung Straße.pdf":        "Überweisung Straße pdf",
+		"README":                        "README",
+		"___":                           "",
+	} {
+		if got := Words(str); got != want {
+			t.Errorf("Words(%q) = %q, want %q", str, got, want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	if got := Match(`debianInstaller "iso"`); got != `"debianInstaller"* "debian"* "Installer"* "iso"*` {
+		t.Errorf("Match = %s", got)
+	}
+	if got := Match(`" * -`); got != "" {
+		t.Errorf("Match of nothing = %s", got)
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// every phase of the pipeline works against the same database, the scan fills up host,
+// explore fills up details and so on
+var (
+	PATH string  = "ftp.sqlite"
+	DB   *sql.DB = nil
+)
+
+// Open connects to the database and brings its schema up to date. WAL lets a phase read
+// while another one is writing
+func Open() (err error) {
+	DB, err = sql.Open(DRIVER, PATH+"?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=1")
+	if err != nil {
+		return err
+	}
+	if err = migrate(); err != nil {
+		DB.Close()
+		return err
+	}
+	return nil
+}
+
+func migrate() error {
+	if err := rebuildTables(); err != nil {
+		return err
+	}
+	for _, schema := range []string{HOST_SCHEMA, DETAILS_SCHEMA, CAPABILITIES_SCHEMA,
+		CERTIFICATE_SCHEMA, HOST_CERTIFICATE_SCHEMA, OPTOUT_SCHEMA, SCAN_RUN_SCHEMA, OBSERVATION_SCHEMA, FILE_SCHEMA} {
+		if _, err := DB.Exec(schema); err != nil {
+			return err
+		}
+	}
+	// columns added over time, failing means they're already there
+	for _, query := range []string{
+		"ALTER TABLE host ADD COLUMN banner TEXT",
+		"ALTER TABLE details ADD COLUMN tls_mode TEXT",
+		"ALTER TABLE details ADD COLUMN tls_version TEXT",
+		"ALTER TABLE details ADD COLUMN tls_cipher TEXT",
+		"ALTER TABLE details ADD COLUMN product TEXT",
+		"ALTER TABLE details ADD COLUMN version TEXT",
+		"ALTER TABLE details ADD COLUMN confidence REAL",
+		"ALTER TABLE details ADD COLUMN explored_at TIMESTAMP",
+		"ALTER TABLE details ADD COLUMN indexed_at TIMESTAMP",
+		"ALTER TABLE scan_run ADD COLUMN rate REAL NOT NULL DEFAULT 0",
+		"ALTER TABLE scan_run ADD COLUMN rate_16 REAL NOT NULL DEFAULT 0",
+		"ALTER TABLE scan_run ADD COLUMN rate_24 REAL NOT NULL DEFAULT 0",
+		"ALTER TABLE scan_run ADD COLUMN stats TEXT",
+	} {
+		DB.Exec(query)
+	}
+	if err := addHistory(); err != nil {
+		return err
+	}
+	// the trigger is created again in case it changed
+	for _, query := range []string{OBSERVATION_INDEX, "DROP TRIGGER IF EXISTS observation_host", OBSERVATION_TRIGGER} {
+		if _, err := DB.Exec(query); err != nil {
+			return err
+		}
+	}
+	if err := uniqueDetails(); err != nil {
+		return err
+	}
+	return migrateSearch()
+}
+
+// rebuildTables upgrades the tables whose key changed as sqlite can't alter those: host
+// and details from the time we were only looking at port 21 and the ip was enough to
+// identify a host, file from before it had an id for the search index. Foreign keys
+// are off while the tables are swapped, a host can't be dropped while details refer to it,
+// and checked once they're all in place
+func rebuildTables() error {
+	rebuilds := []string{}
+	for _, m := range []struct {
+		table  string
+		column string
+		schema string
+		copy   string
+	}{
+		{"host", "port", HOST_SCHEMA, "INSERT INTO host_new(ip, port, timestamp) SELECT ip, 21, timestamp FROM host"},
+		{"details", "related_port", DETAILS_SCHEMA, "INSERT INTO details_new(related_ip, related_port, available, anonymous, ftps, stream) SELECT related_ip, 21, available, anonymous, ftps, stream FROM details"},
+		{"file", "id", FILE_SCHEMA, "INSERT INTO file_new(related_ip, related_port, path, name, type, size, mtime, permissions, timestamp) SELECT related_ip, related_port, path, name, type, size, mtime, permissions, timestamp FROM file"},
+	} {
+		exists, hasColumn := 0, 0
+		DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1", m.table).Scan(&exists)
+		DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2", m.table, m.column).Scan(&hasColumn)
+		if exists == 0 || hasColumn > 0 {
+			continue
+		}
+		rebuilds = append(rebuilds,
+			strings.Replace(m.schema, m.table, m.table+"_new", 1),
+			m.copy,
+			"DROP TABLE "+m.table,
+			"ALTER TABLE "+m.table+"_new RENAME TO "+m.table,
+		)
+	}
+	if len(rebuilds) == 0 {
+		return nil
+	}
+
+	// the pragma applies to a connection and can't change within a transaction
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range rebuilds {
+		if _, err = tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	var table, parent string
+	var rowid sql.NullInt64
+	var fk int
+	if err = tx.QueryRow("PRAGMA foreign_key_check").Scan(&table, &rowid, &parent, &fk); err == nil {
+		return fmt.Errorf("rows of %s refer to missing rows of %s after the upgrade", table, parent)
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	return tx.Commit()
+}
+
+// uniqueDetails keeps a single row of details per host, older databases could have
+// several when a host got probed twice. The latest one wins
+func uniqueDetails() error {
+	var exists int
+	DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'details_host'").Scan(&exists)
+	if exists > 0 {
+		return nil
+	}
+	if _, err := DB.Exec("DELETE FROM details WHERE rowid NOT IN (SELECT MAX(rowid) FROM details GROUP BY related_ip, related_port)"); err != nil {
+		return err
+	}
+	_, err := DB.Exec("CREATE UNIQUE INDEX details_host ON details(related_ip, related_port)")
+	return err
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateBaseline(t *testing.T) {
+	defer func(path string, db *sql.DB) { PATH, DB = path, db }(PATH, DB)
+	PATH = filepath.Join(t.TempDir(), "ftp.sqlite")
+
+	// the database of the first scanner and anonymous prober, details referring to the
+	// host by its ip alone
+	db, err := sql.Open(DRIVER, PATH+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		`CREATE TABLE host (
+  ip VARCHAR(32) PRIMARY KEY,
+  timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`,
+		"CREATE UNIQUE INDEX idx_ip ON host (ip)",
+		`CREATE TABLE details (
+  related_ip TEXT,
+  available BOOL,
+  anonymous BOOL,
+  ftps BOOL,
+  stream TEXT,
+  FOREIGN KEY(related_ip) REFERENCES host(ip)
+)`,
+		"INSERT INTO host(ip) VALUES('8.8.8.8'), ('8.8.4.4'), ('1.1.1.1')",
+		"INSERT INTO details VALUES('8.8.8.8', 1, 1, 0, 'welcome'), ('8.8.4.4', 1, 0, 0, '530 no')",
+	} {
+		if _, err = db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	if err = Open(); err != nil {
+		t.Fatal(err)
+	}
+	hosts, details := 0, 0
+	DB.QueryRow("SELECT COUNT(*) FROM host WHERE port = 21").Scan(&hosts)
+	DB.QueryRow("SELECT COUNT(*) FROM details WHERE related_port = 21").Scan(&details)
+	if hosts != 3 || details != 2 {
+		t.Errorf("got %d hosts and %d details", hosts, details)
+	}
+	// foreign keys are back on
+	if _, err = DB.Exec("INSERT INTO details(related_ip, related_port) VALUES('9.9.9.9', 21)"); err == nil {
+		t.Error("details of an unknown host went in")
+	}
+	DB.Close()
+	if err = Open(); err != nil {
+		t.Fatalf("open again: %v", err)
+	}
+	DB.Close()
+}
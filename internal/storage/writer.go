@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	WRITE_BATCH  int           = 1000
+	WRITE_WINDOW time.Duration = 500 * time.Millisecond
+	WRITE_SLOW   time.Duration = time.Second
+)
+
+// Writer owns the writes of a phase to the database. Workers hand their rows over a
+// channel and a single goroutine commits them in transactions of up to WRITE_BATCH rows
+// or every WRITE_WINDOW, so durability doesn't cost one fsync per row. Rows are committed
+// in the order they were written, a details row can't land before the host it refers to.
+// A row that fails is the only one lost, the others of its batch are committed again
+// without it
+type Writer struct {
+	rows    chan row
+	flushes chan chan error
+	stopped chan struct{}
+	err     error
+	once    sync.Once
+	// closing keeps rows from being sent once the channel is closed, the workers left
+	// behind by a shutdown may still be writing
+	closing sync.RWMutex
+	closed  bool
+
+	mu      sync.Mutex
+	written int64
+	lost    int64
+	commits int64
+	elapsed time.Duration
+	slowest time.Duration
+}
+
+type row struct {
+	query  string
+	values []interface{}
+}
+
+func NewWriter() *Writer {
+	w := &Writer{
+		rows:    make(chan row, WRITE_BATCH),
+		flushes: make(chan chan error),
+		stopped: make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// Write queues a row, the values being the arguments of the query. Rows written after
+// Close are lost
+func (w *Writer) Write(query string, values ...interface{}) {
+	w.closing.RLock()
+	defer w.closing.RUnlock()
+	if w.closed {
+		w.mu.Lock()
+		w.lost++
+		w.mu.Unlock()
+		return
+	}
+	w.rows <- row{query, values}
+}
+
+// Flush blocks until every row written so far is committed
+func (w *Writer) Flush() error {
+	res := make(chan error)
+	select {
+	case w.flushes <- res:
+		return <-res
+	case <-w.stopped:
+		return w.err
+	}
+}
+
+// Close commits what's left and stops the writer, rows can't be written afterward
+func (w *Writer) Close() error {
+	w.once.Do(func() {
+		w.closing.Lock()
+		w.closed = true
+		close(w.rows)
+		w.closing.Unlock()
+	})
+	<-w.stopped
+	return w.err
+}
+
+func (w *Writer) loop() {
+	batch := []row{}
+	ticker := time.NewTicker(WRITE_WINDOW)
+	defer ticker.Stop()
+	commit := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := w.commit(batch)
+		if err != nil {
+			err = w.commitEach(batch)
+		}
+		batch = batch[:0]
+		return err
+	}
+	for {
+		select {
+		case r, ok := <-w.rows:
+			if !ok {
+				w.err = commit()
+				close(w.stopped)
+				return
+			}
+			if batch = append(batch, r); len(batch) >= WRITE_BATCH {
+				commit()
+			}
+		case <-ticker.C:
+			commit()
+		case res := <-w.flushes:
+			// rows sent before the flush might still be waiting in the channel
+			for n := len(w.rows); n > 0; n-- {
+				batch = append(batch, <-w.rows)
+			}
+			res <- commit()
+		}
+	}
+}
+
+func (w *Writer) commit(batch []row) error {
+	start := time.Now()
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	stmts := map[string]*sql.Stmt{}
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+	for _, r := range batch {
+		stmt, ok := stmts[r.query]
+		if !ok {
+			if stmt, err = tx.Prepare(r.query); err != nil {
+				tx.Rollback()
+				return err
+			}
+			stmts[r.query] = stmt
+		}
+		if _, err = stmt.Exec(r.values...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	w.record(len(batch), time.Since(start))
+	return nil
+}
+
+// commitEach commits a batch that failed, each row behind a savepoint so the ones that
+// fail are rolled back on their own. The error is the one of the last row lost
+func (w *Writer) commitEach(batch []row) error {
+	start := time.Now()
+	tx, err := DB.Begin()
+	if err != nil {
+		w.drop(len(batch), err)
+		return err
+	}
+	abort := func(err error) error {
+		tx.Rollback()
+		w.drop(len(batch), err)
+		return err
+	}
+	lost, last := 0, error(nil)
+	for _, r := range batch {
+		if _, err = tx.Exec("SAVEPOINT row"); err != nil {
+			return abort(err)
+		}
+		if _, err = tx.Exec(r.query, r.values...); err != nil {
+			fmt.Printf("\n[writer::error %s, row lost: %v]\n", err.Error(), r.values)
+			lost, last = lost+1, err
+			if _, err = tx.Exec("ROLLBACK TO row"); err != nil {
+				return abort(err)
+			}
+		}
+		if _, err = tx.Exec("RELEASE row"); err != nil {
+			return abort(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		w.drop(len(batch), err)
+		return err
+	}
+	w.record(len(batch)-lost, time.Since(start))
+	w.mu.Lock()
+	w.lost += int64(lost)
+	w.mu.Unlock()
+	return last
+}
+
+func (w *Writer) drop(rows int, err error) {
+	fmt.Printf("\n[writer::error %s, %d rows lost]\n", err.Error(), rows)
+	w.mu.Lock()
+	w.lost += int64(rows)
+	w.mu.Unlock()
+}
+
+func (w *Writer) record(rows int, d time.Duration) {
+	w.mu.Lock()
+	w.written += int64(rows)
+	w.commits++
+	w.elapsed += d
+	if d > w.slowest {
+		w.slowest = d
+	}
+	w.mu.Unlock()
+	if d > WRITE_SLOW {
+		fmt.Printf("\n[writer::slow commit of %d rows in %s]\n", rows, d.Round(time.Millisecond))
+	}
+}
+
+func (w *Writer) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	avg := time.Duration(0)
+	if w.commits > 0 {
+		avg = w.elapsed / time.Duration(w.commits)
+	}
+	str := fmt.Sprintf(
+		"%d rows in %d commits, %s per commit on average, %s at worst",
+		w.written, w.commits, avg.Round(time.Microsecond), w.slowest.Round(time.Microsecond),
+	)
+	if w.lost > 0 {
+		str += fmt.Sprintf(", %d rows lost", w.lost)
+	}
+	return str
+}
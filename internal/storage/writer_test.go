@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	db, err := sql.Open(DRIVER, filepath.Join(t.TempDir(), "ftp.sqlite")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old *sql.DB) { DB = old }(DB)
+	DB = db
+	defer db.Close()
+	if err = migrate(); err != nil {
+		t.Fatal(err)
+	}
+	count := func() (n int) {
+		DB.QueryRow("SELECT COUNT(*) FROM host").Scan(&n)
+		return n
+	}
+
+	defer func(n int, d time.Duration) { WRITE_BATCH, WRITE_WINDOW = n, d }(WRITE_BATCH, WRITE_WINDOW)
+	WRITE_BATCH, WRITE_WINDOW = 10, time.Hour
+	upsert := `INSERT INTO host(ip, port, banner) VALUES($1, $2, $3)
+  ON CONFLICT(ip, port) DO UPDATE SET banner = COALESCE(excluded.banner, host.banner)`
+	w := NewWriter()
+	w.Write(upsert, "8.8.8.8", 21, sql.NullString{String: "220 hello", Valid: true})
+	if err = w.Flush(); err != nil || count() != 1 {
+		t.Fatalf("flush: %v, %d rows", err, count())
+	}
+	// a row without banner keeps the one we know
+	w.Write(upsert, "8.8.8.8", 21, sql.NullString{})
+	for i := 0; i < 24; i++ {
+		w.Write(upsert, "8.8.4.4", 2000+i, sql.NullString{})
+	}
+	if err = w.Close(); err != nil || count() != 25 {
+		t.Fatalf("close: %v, %d rows", err, count())
+	}
+	banner := ""
+	DB.QueryRow("SELECT banner FROM host WHERE ip = '8.8.8.8'").Scan(&banner)
+	if banner != "220 hello" {
+		t.Errorf("banner was overwritten with %q", banner)
+	}
+	if w.commits != 4 || w.written != 26 {
+		t.Errorf("unexpected report: %s", w.String())
+	}
+	if err = w.Flush(); err != nil {
+		t.Errorf("flush after close: %v", err)
+	}
+	// workers left behind by a shutdown can still write, what they write is lost
+	w.Write(upsert, "8.8.8.8", 22, sql.NullString{})
+	if w.lost != 1 || count() != 25 {
+		t.Errorf("write after close: %s", w.String())
+	}
+}
+
+func TestWriterOrder(t *testing.T) {
+	db, err := sql.Open(DRIVER, filepath.Join(t.TempDir(), "ftp.sqlite")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old *sql.DB) { DB = old }(DB)
+	DB = db
+	defer db.Close()
+	if err = migrate(); err != nil {
+		t.Fatal(err)
+	}
+	// a details row refers to its host, both end up in the same transaction
+	w := NewWriter()
+	for i := 0; i < 10; i++ {
+		w.Write("INSERT INTO host(ip, port) VALUES($1, $2)", "8.8.8.8", 2000+i)
+		w.Write("INSERT INTO details(related_ip, related_port, available) VALUES($1, $2, $3)", "8.8.8.8", 2000+i, true)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	DB.QueryRow("SELECT COUNT(*) FROM details").Scan(&n)
+	if n != 10 {
+		t.Errorf("got %d details, want 10", n)
+	}
+}
+
+func TestWriterBadRow(t *testing.T) {
+	db, err := sql.Open(DRIVER, filepath.Join(t.TempDir(), "ftp.sqlite")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old *sql.DB) { DB = old }(DB)
+	DB = db
+	defer db.Close()
+	if err = migrate(); err != nil {
+		t.Fatal(err)
+	}
+	// the details of a host purged by the optout registry meanwhile share the batch of
+	// other hosts, those don't go away with it
+	w := NewWriter()
+	for i := 0; i < 5; i++ {
+		w.Write("INSERT INTO host(ip, port) VALUES($1, $2)", "8.8.8.8", 2000+i)
+		w.Write("INSERT INTO details(related_ip, related_port, available) VALUES($1, $2, $3)", "8.8.8.8", 2000+i, true)
+	}
+	w.Write("INSERT INTO details(related_ip, related_port, available) VALUES($1, $2, $3)", "9.9.9.9", 21, true)
+	w.Write("INSERT INTO host(ip, port) VALUES($1, $2)", "8.8.4.4", 21)
+	if err = w.Close(); err == nil {
+		t.Error("the row lost wasn't reported")
+	}
+	hosts, details := 0, 0
+	DB.QueryRow("SELECT COUNT(*) FROM host").Scan(&hosts)
+	DB.QueryRow("SELECT COUNT(*) FROM details").Scan(&details)
+	if hosts != 6 || details != 5 || w.written != 11 || w.lost != 1 {
+		t.Errorf("got %d hosts and %d details, %s", hosts, details, w.String())
+	}
+}
@@ -1,5 +0,0 @@
-module github.com/mickael-kerjean/ftpscan
-
-go 1.16
-
-require github.com/mattn/go-sqlite3 v1.14.8